@@ -0,0 +1,133 @@
+package main
+
+import (
+	"image"
+	"math"
+)
+
+// barColors are the seven color bars in the usual order, at full level.
+var barColors = [][3]float64{
+	{1, 1, 1}, // white
+	{1, 1, 0}, // yellow
+	{0, 1, 1}, // cyan
+	{0, 1, 0}, // green
+	{1, 0, 1}, // magenta
+	{1, 0, 0}, // red
+	{0, 0, 1}, // blue
+}
+
+func scaleSignal(v [3]float64, level float64) [3]float64 {
+	return [3]float64{v[0] * level, v[1] * level, v[2] * level}
+}
+
+// barSpan is one block of a row of bars, with its width as a fraction of
+// the row.
+type barSpan struct {
+	width float64
+	color [3]float64
+}
+
+// fillBars fills the rows of img from y0 to y1 with spans, rounding their
+// edges to whole pixels so that they always fill the row.
+func fillBars(img *signalImage, y0, y1 int, spans []barSpan) {
+	w := float64(img.rect.Dx())
+	pos := 0.0
+	for _, span := range spans {
+		x0 := int(math.Round(pos * w))
+		pos += span.width
+		x1 := int(math.Round(pos * w))
+		img.fill(image.Rect(x0, y0, x1, y1), span.color)
+	}
+}
+
+// ebuBars renders the EBU full field bars at n percent, with the white bar
+// always at 100%, so n=75 gives 100/0/75/0 bars and n=100 gives 100/0/100/0.
+func ebuBars(s image.Point, n int, _ params) image.Image {
+	img := newSignalImage(s)
+	level := float64(n) / 100
+
+	spans := []barSpan{{1.0 / 8, barColors[0]}}
+	for _, c := range barColors[1:] {
+		spans = append(spans, barSpan{1.0 / 8, scaleSignal(c, level)})
+	}
+	spans = append(spans, barSpan{1.0 / 8, signalGray(0)})
+	fillBars(img, 0, s.Y, spans)
+	return img
+}
+
+// The NTSC −I and +Q axes at 20% amplitude, with the luma raised just
+// enough to keep every component at or above black.
+var (
+	minusISignal = [3]float64{0, 0.2456, 0.4124}
+	qSignal      = [3]float64{0.2536, 0, 0.4700}
+)
+
+// hdBars returns a renderer for the SMPTE RP 219 and ARIB STD-B28 HD color
+// bars, which share a layout and differ only in the optional patches *2 and
+// *3 at the left of the second and third rows. The bars in the top row are
+// at n percent.
+//
+// The layout is defined for 16:9 frames, and is stretched to fit others:
+// the side pillars are 1/8 of the width, and the seven bars between them
+// share the rest.
+func hdBars(star2, star3 [3]float64) imageFunc {
+	return func(s image.Point, n int, _ params) image.Image {
+		img := newSignalImage(s)
+		level := float64(n) / 100
+		d := 1.0 / 8
+		c := 3.0 / 4 / 7
+
+		row1 := []barSpan{{d, signalGray(0.4)}}
+		for _, bar := range barColors {
+			row1 = append(row1, barSpan{c, scaleSignal(bar, level)})
+		}
+		row1 = append(row1, barSpan{d, signalGray(0.4)})
+
+		row2 := []barSpan{
+			{d, barColors[2]},
+			{c, star2},
+			{6 * c, signalGray(0.75)},
+			{d, barColors[6]},
+		}
+
+		row4 := []barSpan{
+			{d, signalGray(0.15)},
+			{1.5 * c, signalGray(0)},
+			{2 * c, signalGray(1)},
+			{5.0 / 6 * c, signalGray(0)},
+			{c / 3, signalGray(-0.02)},
+			{c / 3, signalGray(0)},
+			{c / 3, signalGray(0.02)},
+			{c / 3, signalGray(0)},
+			{c / 3, signalGray(0.04)},
+			{c, signalGray(0)},
+			{d, signalGray(0.15)},
+		}
+
+		h := float64(s.Y)
+		y1 := int(math.Round(h * 7 / 12))
+		y2 := int(math.Round(h * 8 / 12))
+		y3 := int(math.Round(h * 9 / 12))
+		fillBars(img, 0, y1, row1)
+		fillBars(img, y1, y2, row2)
+		fillBars(img, y3, s.Y, row4)
+
+		// The third row has a ramp from black to white across the second
+		// to sixth bars, and white under the seventh.
+		w := float64(s.X)
+		fillBars(img, y2, y3, []barSpan{
+			{d, barColors[1]},
+			{c, star3},
+			{5 * c, signalGray(0)},
+			{c, signalGray(1)},
+			{d, barColors[5]},
+		})
+		x0 := int(math.Round((d + c) * w))
+		x1 := int(math.Round((d + 6*c) * w))
+		for x := x0; x < x1; x++ {
+			v := signalGray(float64(x-x0) / float64(max(x1-x0-1, 1)))
+			img.fill(image.Rect(x, y2, x+1, y3), v)
+		}
+		return img
+	}
+}
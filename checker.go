@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// labPatch is a chart patch given by its CIE L*a*b* under D50.
+type labPatch struct {
+	name string
+	lab  [3]float64
+}
+
+// colorCheckerClassic holds the published L*a*b* D50 values of the 24
+// patches of the ColorChecker Classic, in rows from the top left.
+var colorCheckerClassic = []labPatch{
+	{"dark skin", [3]float64{37.54, 14.37, 14.92}},
+	{"light skin", [3]float64{64.66, 19.27, 17.5}},
+	{"blue sky", [3]float64{49.32, -3.82, -22.54}},
+	{"foliage", [3]float64{43.46, -12.74, 22.72}},
+	{"blue flower", [3]float64{54.94, 9.61, -24.79}},
+	{"bluish green", [3]float64{70.48, -32.26, -0.37}},
+	{"orange", [3]float64{62.73, 35.83, 56.5}},
+	{"purplish blue", [3]float64{39.43, 10.75, -45.17}},
+	{"moderate red", [3]float64{50.57, 48.64, 16.67}},
+	{"purple", [3]float64{30.1, 22.54, -20.87}},
+	{"yellow green", [3]float64{71.77, -24.13, 58.19}},
+	{"orange yellow", [3]float64{71.51, 18.24, 67.37}},
+	{"blue", [3]float64{28.37, 15.42, -49.8}},
+	{"green", [3]float64{54.38, -39.72, 32.27}},
+	{"red", [3]float64{42.43, 51.05, 28.62}},
+	{"yellow", [3]float64{81.8, 2.67, 80.41}},
+	{"magenta", [3]float64{50.63, 51.28, -14.12}},
+	{"cyan", [3]float64{49.57, -29.71, -28.32}},
+	{"white 9.5", [3]float64{95.19, -1.03, 2.93}},
+	{"neutral 8", [3]float64{81.29, -0.57, 0.44}},
+	{"neutral 6.5", [3]float64{66.89, -0.75, -0.06}},
+	{"neutral 5", [3]float64{50.76, -0.13, 0.14}},
+	{"neutral 3.5", [3]float64{35.63, -0.46, -0.48}},
+	{"black 2", [3]float64{20.64, 0.07, -0.46}},
+}
+
+// chart is the value of a chartParam: the patches read from a CGATS file,
+// or the ColorChecker Classic if file is empty.
+type chart struct {
+	file    string
+	patches []labPatch
+}
+
+func (c chart) String() string {
+	return c.file
+}
+
+func loadChart(file string) (chart, error) {
+	if file == "" {
+		return chart{patches: colorCheckerClassic}, nil
+	}
+	patches, err := readCGATS(file)
+	return chart{file: file, patches: patches}, err
+}
+
+// readCGATS reads the SAMPLE_ID or SAMPLE_NAME and LAB_L, LAB_A and LAB_B
+// fields of each sample in a CGATS.17 file, as written for the
+// ColorChecker SG and other charts.
+func readCGATS(name string) ([]labPatch, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var fields []string
+	var patches []labPatch
+	inFormat, inData := false, false
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.Fields(sc.Text())
+		if len(line) == 0 || strings.HasPrefix(line[0], "#") {
+			continue
+		}
+		for i := range line {
+			line[i] = strings.Trim(line[i], `"`)
+		}
+
+		switch line[0] {
+		case "BEGIN_DATA_FORMAT":
+			inFormat = true
+			continue
+		case "END_DATA_FORMAT":
+			inFormat = false
+			continue
+		case "BEGIN_DATA":
+			inData = true
+			continue
+		case "END_DATA":
+			inData = false
+			continue
+		}
+		if inFormat {
+			fields = append(fields, line...)
+			continue
+		}
+		if !inData {
+			continue
+		}
+		if len(line) != len(fields) {
+			return nil, fmt.Errorf("%s: %d values in a row of %d fields", name, len(line), len(fields))
+		}
+
+		var p labPatch
+		found := 0
+		for i, field := range fields {
+			switch field {
+			case "SAMPLE_ID":
+				if p.name == "" {
+					p.name = line[i]
+				}
+			case "SAMPLE_NAME":
+				p.name = line[i]
+			case "LAB_L", "LAB_A", "LAB_B":
+				v, err := strconv.ParseFloat(line[i], 64)
+				if err != nil {
+					return nil, fmt.Errorf("%s: bad %s %q", name, field, line[i])
+				}
+				p.lab[strings.Index("LAB", field[4:])] = v
+				found++
+			}
+		}
+		if found != 3 {
+			return nil, fmt.Errorf("%s: no LAB_L, LAB_A and LAB_B fields", name)
+		}
+		patches = append(patches, p)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(patches) == 0 {
+		return nil, fmt.Errorf("%s: no samples", name)
+	}
+	return patches, nil
+}
+
+// colorChecker renders the patches of a chart in rows of n, as large as
+// the frame allows while staying square, centered on bg. The L*a*b*
+// values are adapted from D50 to D65 with the Bradford transform and
+// converted to outputPrimaries, clipping any out of gamut.
+func colorChecker(s image.Point, n int, p params) image.Image {
+	patches := p.Chart("data").patches
+
+	pic := newLinear(s, p.RGB("bg"))
+
+	cols := n
+	rows := (len(patches) + cols - 1) / cols
+	cell := math.Min(float64(s.X)/float64(cols), float64(s.Y)/float64(rows))
+	gap := cell / 8
+	x0 := (float64(s.X) - cell*float64(cols)) / 2
+	y0 := (float64(s.Y) - cell*float64(rows)) / 2
+
+	adapt := bradford(d50, d65)
+	var dark, light []textLabel
+	for i, patch := range patches {
+		xyz := mulVec(adapt, labToXYZ(patch.lab, d50))
+		c := linearColor{space: outputPrimaries, rgb: mulVec(outputPrimaries.fromXYZ, xyz)}
+
+		x := x0 + float64(i%cols)*cell
+		y := y0 + float64(i/cols)*cell
+		r := image.Rect(int(math.Round(x+gap/2)), int(math.Round(y+gap/2)),
+			int(math.Round(x+cell-gap/2)), int(math.Round(y+cell-gap/2)))
+		pic.fill(r, c.in(outputPrimaries))
+
+		l := textLabel{text: patch.name, x: x + cell/2, y: y + cell - gap/2 - cell/10}
+		if patch.lab[0] < 60 {
+			dark = append(dark, l)
+		} else {
+			light = append(light, l)
+		}
+	}
+
+	if p.Choice("labels") == "names" {
+		size := cell / 10
+		drawLinearLabels(pic, dark, size, [3]float64{0.6, 0.6, 0.6})
+		drawLinearLabels(pic, light, size, [3]float64{0.02, 0.02, 0.02})
+	}
+	return pic
+}
+
+// drawLinearLabels draws labels on a linear image in ink, blending their
+// antialiased edges in linear light.
+func drawLinearLabels(pic *linearImage, labels []textLabel, size float64, ink [3]float64) {
+	b := pic.Bounds()
+	mask := labelMask(b.Size(), labels, size)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			a := float64(mask.Pix[mask.PixOffset(x-b.Min.X, y-b.Min.Y)+3]) / 255
+			if a == 0 {
+				continue
+			}
+			pic.set(x, y, mixLinear(pic.rgb(x, y), ink, a))
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"image"
+	"strings"
+)
+
+// chromaColors are the primaries and secondaries at full level.
+var chromaColors = [][3]float64{
+	{1, 0, 0}, // red
+	{0, 1, 0}, // green
+	{0, 0, 1}, // blue
+	{0, 1, 1}, // cyan
+	{1, 0, 1}, // magenta
+	{1, 1, 0}, // yellow
+}
+
+// chromaLines renders lines n pixels wide in each of chromaColors on black,
+// vertical in the top half and horizontal in the bottom half. Vertical lines
+// narrower than two pixels lose their color under 4:2:2 and 4:2:0, and
+// horizontal ones only under 4:2:0.
+func chromaLines(s image.Point, n int, _ params) image.Image {
+	img := newSignalImage(s)
+	mid := s.Y / 4 * 2 // even, to line up with 4:2:0 chroma
+	for i, c := range chromaColors {
+		x0 := s.X * i / len(chromaColors)
+		x1 := s.X * (i + 1) / len(chromaColors)
+		for x := x0; x < x1; x++ {
+			if (x/n)%2 == 0 {
+				img.fill(image.Rect(x, 0, x+1, mid), c)
+			}
+		}
+		for y := mid; y < s.Y; y++ {
+			if ((y-mid)/n)%2 == 0 {
+				img.fill(image.Rect(x0, y, x1, y+1), c)
+			}
+		}
+	}
+	return img
+}
+
+// chromaTextPairs are the ink and background colors of the strips of
+// chromaText, chosen so that the text relies on chroma more than luma.
+var chromaTextPairs = [][2][3]float64{
+	{{1, 0, 0}, {0, 0, 1}},
+	{{0, 0, 1}, {1, 0, 0}},
+	{{0, 1, 0}, {1, 0, 1}},
+	{{1, 0, 1}, {0, 1, 0}},
+	{{1, 1, 0}, {0, 0, 1}},
+	{{0, 1, 1}, {1, 0, 0}},
+}
+
+const chromaSample = "The quick brown fox jumps over the lazy dog 0123456789 "
+
+// chromaText renders strips of colored text n pixels high on colored
+// backgrounds, which blurs and changes color at the edges of the strokes
+// under subsampling.
+func chromaText(s image.Point, n int, _ params) image.Image {
+	img := newSignalImage(s)
+	size := float64(n)
+
+	// The sample is repeated to fill the width, at a rough estimate of
+	// the Go font's width.
+	text := strings.Repeat(chromaSample, int(float64(s.X)/(0.5*size*float64(len(chromaSample))))+1)
+	for i, pair := range chromaTextPairs {
+		y0 := s.Y * i / len(chromaTextPairs)
+		y1 := s.Y * (i + 1) / len(chromaTextPairs)
+		img.fill(image.Rect(0, y0, s.X, y1), pair[1])
+
+		var labels []textLabel
+		for y := float64(y0) + size; y+size/2 < float64(y1); y += 1.5 * size {
+			labels = append(labels, textLabel{text: text, x: float64(s.X) / 2, y: y})
+		}
+		ink := pair[0]
+		img.drawLabels(labels, size, func([3]float64) [3]float64 { return ink })
+	}
+	return img
+}
+
+// chromaColumns renders alternating stripes n pixels wide of two colors
+// with the same luma under the output Y′CbCr matrix, as columns in the top
+// half and rows in the bottom half. Averaging the chroma of the two turns
+// the stripes to a flat gray, so the columns vanish under 4:2:2 and 4:2:0,
+// and the rows only under 4:2:0.
+func chromaColumns(s image.Point, n int, _ params) image.Image {
+	img := newSignalImage(s)
+	m := outputMatrix()
+
+	// Offsets along the magenta to green axis leave luma unchanged. The
+	// gray between them is off the half way code, which rounds unevenly.
+	const d = 0.4
+	g := -d * (m.kr + m.kb) / (1 - m.kr - m.kb)
+	a := [3]float64{0.45 + d, 0.45 + g, 0.45 + d}
+	b := [3]float64{0.45 - d, 0.45 - g, 0.45 - d}
+
+	mid := s.Y / 4 * 2
+	for x := 0; x < s.X; x++ {
+		c := a
+		if (x/n)%2 == 1 {
+			c = b
+		}
+		img.fill(image.Rect(x, 0, x+1, mid), c)
+	}
+	for y := mid; y < s.Y; y++ {
+		c := a
+		if ((y-mid)/n)%2 == 1 {
+			c = b
+		}
+		img.fill(image.Rect(0, y, s.X, y+1), c)
+	}
+	return img
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"strings"
+)
+
+// colorSpace is a set of RGB primaries with a D65 white point. Pattern
+// colors are given in one color space and converted to outputPrimaries
+// before rendering, so the rendered image is already in the output space.
+type colorSpace struct {
+	name        string
+	description string
+
+	// cicp is the ITU-T H.273 colour primaries code.
+	cicp byte
+
+	toXYZ   [3][3]float64
+	fromXYZ [3][3]float64
+}
+
+var (
+	rec709  = newColorSpace("rec709", "ITU-R BT.709 and sRGB", 1, [2]float64{0.64, 0.33}, [2]float64{0.30, 0.60}, [2]float64{0.15, 0.06})
+	p3      = newColorSpace("p3", "Display P3 (DCI-P3 primaries, D65 white)", 12, [2]float64{0.680, 0.320}, [2]float64{0.265, 0.690}, [2]float64{0.150, 0.060})
+	rec2020 = newColorSpace("rec2020", "ITU-R BT.2020 and BT.2100", 9, [2]float64{0.708, 0.292}, [2]float64{0.170, 0.797}, [2]float64{0.131, 0.046})
+)
+
+var colorSpaces = []*colorSpace{rec709, p3, rec2020}
+
+var (
+	d65 = [2]float64{0.3127, 0.3290}
+	d50 = [2]float64{0.3457, 0.3585}
+)
+
+var (
+	// outputPrimaries are the primaries of the files written. If not set,
+	// they are rec2020 for HDR transfers and rec709 otherwise.
+	outputPrimaries *colorSpace
+
+	// inputSpace is the color space of pattern colors given without one.
+	inputSpace = rec709
+)
+
+func newColorSpace(name, description string, cicp byte, r, g, b [2]float64) *colorSpace {
+	cs := &colorSpace{name: name, description: description, cicp: cicp}
+
+	// Columns of the matrix are the XYZ of each primary, scaled so that
+	// the three sum to the white point with Y = 1.
+	var m [3][3]float64
+	for i, xy := range [][2]float64{r, g, b} {
+		m[0][i] = xy[0] / xy[1]
+		m[1][i] = 1
+		m[2][i] = (1 - xy[0] - xy[1]) / xy[1]
+	}
+	s := mulVec(invert(m), whiteXYZ(d65))
+	for row := range m {
+		for col := range m[row] {
+			m[row][col] *= s[col]
+		}
+	}
+
+	cs.toXYZ = m
+	cs.fromXYZ = invert(m)
+	return cs
+}
+
+func findColorSpace(name string) (*colorSpace, error) {
+	var names []string
+	for _, cs := range colorSpaces {
+		if strings.EqualFold(name, cs.name) {
+			return cs, nil
+		}
+		names = append(names, cs.name)
+	}
+	return nil, fmt.Errorf("unknown color space %q: want one of %s", name, strings.Join(names, ", "))
+}
+
+// colorSpaceFlag sets a *colorSpace from its name.
+type colorSpaceFlag struct {
+	cs **colorSpace
+}
+
+func (f colorSpaceFlag) String() string {
+	if f.cs == nil || *f.cs == nil {
+		return ""
+	}
+	return (*f.cs).name
+}
+
+func (f colorSpaceFlag) Set(v string) error {
+	cs, err := findColorSpace(v)
+	if err != nil {
+		return err
+	}
+	*f.cs = cs
+	return nil
+}
+
+// linearColor is a linear-light RGB color in a given color space, or in
+// inputSpace if space is nil.
+type linearColor struct {
+	space *colorSpace
+	rgb   [3]float64
+}
+
+func newLinearColor(c color.RGBA64) linearColor {
+	return linearColor{rgb: [3]float64{float64(c.R) / 65535, float64(c.G) / 65535, float64(c.B) / 65535}}
+}
+
+// in converts c to cs, clipping anything outside its gamut.
+func (c linearColor) in(cs *colorSpace) [3]float64 {
+	from := c.space
+	if from == nil {
+		from = inputSpace
+	}
+	rgb := c.rgb
+	if from != cs {
+		rgb = mulVec(cs.fromXYZ, mulVec(from.toXYZ, rgb))
+	}
+	for i := range rgb {
+		rgb[i] = math.Min(math.Max(rgb[i], 0), 1)
+	}
+	return rgb
+}
+
+func (c linearColor) String() string {
+	var s string
+	if c.space != nil {
+		s = c.space.name + ":"
+	}
+	if c.rgb[0] == c.rgb[1] && c.rgb[1] == c.rgb[2] {
+		return s + fmt.Sprintf("%.4g", c.rgb[0])
+	}
+	return s + fmt.Sprintf("%.4g,%.4g,%.4g", c.rgb[0], c.rgb[1], c.rgb[2])
+}
+
+// whiteXYZ returns the XYZ of a white point with Y = 1.
+func whiteXYZ(xy [2]float64) [3]float64 {
+	return [3]float64{xy[0] / xy[1], 1, (1 - xy[0] - xy[1]) / xy[1]}
+}
+
+// labToXYZ converts CIE L*a*b* relative to white to XYZ with white at Y = 1.
+func labToXYZ(lab [3]float64, white [2]float64) [3]float64 {
+	fy := (lab[0] + 16) / 116
+	f := [3]float64{fy + lab[1]/500, fy, fy - lab[2]/200}
+	w := whiteXYZ(white)
+	var xyz [3]float64
+	for i, v := range f {
+		if v > 6.0/29 {
+			xyz[i] = v * v * v * w[i]
+		} else {
+			xyz[i] = 3 * (6.0 / 29) * (6.0 / 29) * (v - 4.0/29) * w[i]
+		}
+	}
+	return xyz
+}
+
+// bradford returns the Bradford chromatic adaptation from one white point
+// to another.
+func bradford(from, to [2]float64) [3][3]float64 {
+	m := [3][3]float64{
+		{0.8951, 0.2664, -0.1614},
+		{-0.7502, 1.7135, 0.0367},
+		{0.0389, -0.0685, 1.0296},
+	}
+	src := mulVec(m, whiteXYZ(from))
+	dst := mulVec(m, whiteXYZ(to))
+	var scale [3][3]float64
+	for i := range scale {
+		scale[i][i] = dst[i] / src[i]
+	}
+	return mulMat(invert(m), mulMat(scale, m))
+}
+
+func mulMat(a, b [3][3]float64) [3][3]float64 {
+	var out [3][3]float64
+	for row := range out {
+		for col := range out[row] {
+			for k := range a {
+				out[row][col] += a[row][k] * b[k][col]
+			}
+		}
+	}
+	return out
+}
+
+func mulVec(m [3][3]float64, v [3]float64) [3]float64 {
+	var out [3]float64
+	for row := range m {
+		out[row] = m[row][0]*v[0] + m[row][1]*v[1] + m[row][2]*v[2]
+	}
+	return out
+}
+
+func invert(m [3][3]float64) [3][3]float64 {
+	a, b, c := m[0][0], m[0][1], m[0][2]
+	d, e, f := m[1][0], m[1][1], m[1][2]
+	g, h, i := m[2][0], m[2][1], m[2][2]
+
+	det := a*(e*i-f*h) - b*(d*i-f*g) + c*(d*h-e*g)
+	return [3][3]float64{
+		{(e*i - f*h) / det, (c*h - b*i) / det, (b*f - c*e) / det},
+		{(f*g - d*i) / det, (a*i - c*g) / det, (c*d - a*f) / det},
+		{(d*h - e*g) / det, (b*g - a*h) / det, (a*e - b*d) / det},
+	}
+}
+
+// lstar returns the CIE 1976 lightness, from 0 to 100, of a relative
+// luminance y.
+func lstar(y float64) float64 {
+	if y <= 216.0/24389 {
+		return y * 24389 / 27
+	}
+	return 116*math.Cbrt(y) - 16
+}
+
+// lstarInverse returns the relative luminance of lightness l.
+func lstarInverse(l float64) float64 {
+	if l <= 8 {
+		return l * 27 / 24389
+	}
+	return math.Pow((l+16)/116, 3)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/fogleman/gg"
+)
+
+// vec is a point in pixel coordinates, where pixel x, y covers the square
+// from x, y to x+1, y+1.
+type vec struct {
+	x, y float64
+}
+
+func pixelSquare(x, y int) []vec {
+	fx, fy := float64(x), float64(y)
+	return []vec{{fx, fy}, {fx + 1, fy}, {fx + 1, fy + 1}, {fx, fy + 1}}
+}
+
+// clip returns the part of the convex polygon poly where a·x + b·y + c is
+// at least 0.
+func clip(poly []vec, a, b, c float64) []vec {
+	var out []vec
+	for i, p := range poly {
+		q := poly[(i+1)%len(poly)]
+		dp := a*p.x + b*p.y + c
+		dq := a*q.x + b*q.y + c
+		if dp >= 0 {
+			out = append(out, p)
+		}
+		if (dp >= 0) != (dq >= 0) {
+			t := dp / (dp - dq)
+			out = append(out, vec{p.x + t*(q.x-p.x), p.y + t*(q.y-p.y)})
+		}
+	}
+	return out
+}
+
+func area(poly []vec) float64 {
+	var sum float64
+	for i, p := range poly {
+		q := poly[(i+1)%len(poly)]
+		sum += p.x*q.y - q.x*p.y
+	}
+	return math.Abs(sum) / 2
+}
+
+// mixLinear returns the color a fraction t of the way from a to b, in
+// linear light.
+func mixLinear(a, b [3]float64, t float64) [3]float64 {
+	var out [3]float64
+	for i := range out {
+		out[i] = a[i] + t*(b[i]-a[i])
+	}
+	return out
+}
+
+// newLinear returns an image of size s filled with the linear light color c.
+func newLinear(s image.Point, c [3]float64) *linearImage {
+	pic := newLinearImage(image.Rect(0, 0, s.X, s.Y))
+	pic.fill(pic.rect, c)
+	return pic
+}
+
+// newMaskCtx is newCtx for drawing the coverage of a shape in white on a
+// transparent context, to paint onto a linear image with paintMask. gg only
+// keeps 8 bits, which is enough for coverage but not for colors.
+func newMaskCtx(s image.Point) (ctx *gg.Context, b floatRect, l float64) {
+	ctx, b, l = newCtx(s, nil)
+	ctx.SetColor(color.White)
+	return
+}
+
+// paintMask blends c into pic in linear light, as far as ctx covers each
+// pixel, and returns pic.
+func paintMask(pic *linearImage, ctx *gg.Context, c [3]float64) *linearImage {
+	mask := ctx.Image().(*image.RGBA)
+	b := pic.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			a := float64(mask.Pix[mask.PixOffset(x, y)+3]) / 255
+			if a == 0 {
+				continue
+			}
+			pic.set(x, y, mixLinear(pic.rgb(x, y), c, a))
+		}
+	}
+	return pic
+}
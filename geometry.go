@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// Overscan markers and safe areas, in percent of the frame.
+var (
+	overscanMarks = []float64{2.5, 5, 10}
+	actionSafe    = 93.0
+	titleSafe     = 90.0
+)
+
+// aspectGuides are the shapes of picture marked on a geometry target, by
+// width over height.
+var aspectGuides = []struct {
+	name  string
+	ratio float64
+}{
+	{"4:3", 4.0 / 3},
+	{"16:9", 16.0 / 9},
+	{"1.85", 1.85},
+	{"2.39", 2.39},
+}
+
+// geometry renders a target for checking overscan, centering and aspect
+// ratio, with lines n pixels wide. The border covers the outermost pixels
+// of the frame, and straight lines lie on whole pixels so that they stay
+// sharp when the frame is shown pixel for pixel.
+func geometry(s image.Point, n int, p params) image.Image {
+	ctx, _, _ := newMaskCtx(s)
+	ctx.Identity()
+
+	w, h := float64(s.X), float64(s.Y)
+	short := math.Min(w, h)
+	lw := float64(n)
+	size := math.Max(short/48, 8)
+	ctx.SetFontFace(labelFace(size))
+
+	// outline draws a rectangle inset by x and y pixels from the frame
+	// edges, with its outer edge on that inset.
+	outline := func(x, y float64) {
+		ctx.DrawRectangle(x, y, w-2*x, lw)
+		ctx.DrawRectangle(x, h-y-lw, w-2*x, lw)
+		ctx.DrawRectangle(x, y, lw, h-2*y)
+		ctx.DrawRectangle(w-x-lw, y, lw, h-2*y)
+		ctx.Fill()
+	}
+	inset := func(side, percent float64) float64 {
+		return math.Round(side * percent / 200)
+	}
+	centerX, centerY := math.Floor((w-lw)/2), math.Floor((h-lw)/2)
+
+	// Aspect ratio guides are pillarbox or letterbox edges, behind the
+	// rest, with their labels spread out in case they are close together.
+	for i, g := range aspectGuides {
+		at := 0.2 + 0.1*float64(i)
+		switch a := w / h; {
+		case g.ratio < a-0.01:
+			x := math.Round((w - h*g.ratio) / 2)
+			ctx.DrawRectangle(x, 0, lw, h)
+			ctx.DrawRectangle(w-x-lw, 0, lw, h)
+			ctx.Fill()
+			ctx.DrawStringAnchored(g.name, x+lw+size/4, h*at, 0, 0.5)
+		case g.ratio > a+0.01:
+			y := math.Round((h - w/g.ratio) / 2)
+			ctx.DrawRectangle(0, y, w, lw)
+			ctx.DrawRectangle(0, h-y-lw, w, lw)
+			ctx.Fill()
+			ctx.DrawStringAnchored(g.name, w*at, y+lw+size/2, 0, 0.5)
+		}
+	}
+
+	pic := paintMask(newLinear(s, p.RGB("bg")), ctx, p.RGB("guides"))
+
+	// The rest is drawn in fg over the guides.
+	ctx.SetColor(color.Transparent)
+	ctx.Clear()
+	ctx.SetColor(color.White)
+	outline(0, 0)
+
+	// Safe areas, labeled inside their top and bottom edges.
+	x, y := inset(w, 100-titleSafe), inset(h, 100-titleSafe)
+	outline(x, y)
+	ctx.DrawStringAnchored(fmt.Sprintf("title safe %g%%", titleSafe), w*0.6, y+lw+size/2, 0, 0.5)
+	x, y = inset(w, 100-actionSafe), inset(h, 100-actionSafe)
+	outline(x, y)
+	ctx.DrawStringAnchored(fmt.Sprintf("action safe %g%%", actionSafe), w*0.6, h-y-lw-size/2, 0, 0.5)
+
+	// Overscan markers are bars at the middle of each side, running in
+	// from the frame edge to m% of the width or height, so that a bar is
+	// whole only if no more than that is lost off the side.
+	bar := math.Max(lw, math.Round(size/2))
+	for i, m := range overscanMarks {
+		x, y := inset(2*w, m), inset(2*h, m)
+		off := (float64(i) - 1) * 2 * bar
+		ctx.DrawRectangle(0, centerY+off, x, bar)
+		ctx.DrawRectangle(w-x, centerY+off, x, bar)
+		ctx.DrawRectangle(centerX+off, 0, bar, y)
+		ctx.DrawRectangle(centerX+off, h-y, bar, y)
+		ctx.Fill()
+		label := fmt.Sprintf("%g%%", m)
+		ctx.DrawStringAnchored(label, x+size/4, centerY+off+bar/2, 0, 0.5)
+		ctx.DrawStringAnchored(label, w-x-size/4, centerY+off+bar/2, 1, 0.5)
+	}
+
+	// Center crosshair.
+	cross := math.Round(short / 10)
+	ctx.DrawRectangle(centerX+lw/2-cross/2, centerY, cross, lw)
+	ctx.DrawRectangle(centerX, centerY+lw/2-cross/2, lw, cross)
+	ctx.Fill()
+
+	// Circles should be round on a display with square pixels: one in each
+	// corner, touching the frame edges, and a large one in the center,
+	// touching the title safe area across the short side.
+	ctx.SetLineWidth(lw)
+	r := short / 10
+	for _, c := range [][2]float64{{r, r}, {w - r, r}, {r, h - r}, {w - r, h - r}} {
+		ctx.DrawCircle(c[0], c[1], r-lw/2)
+	}
+	ctx.DrawCircle(w/2, h/2, short/2-inset(short, 100-titleSafe)-lw/2)
+	ctx.Stroke()
+
+	return paintMask(pic, ctx, p.RGB("fg"))
+}
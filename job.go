@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// jobFile is the JSON form of a render plan. Loading one with -job replaces
+// the built-in renderSets, and its line counts replace lineCountList.
+//
+//	{
+//	  "n": [2, 5, 10],
+//	  "sizes": [
+//	    {"name": "tv", "size": "3840x2160", "patterns": ["jail*", "rings"]},
+//	    {"name": "proj", "size": "proj", "n": "10-60:10"}
+//	  ],
+//	  "patterns": {
+//	    "field": {"n": "0-255", "params": {"levels": 255}},
+//	    "jail*": {"params": {"maxWidth": 3}}
+//	  },
+//	  "variants": {
+//	    "jailRed": {"base": "jailBlack", "params": {"fg": "1,0,0"}}
+//	  },
+//	  "transfer": "bt1886",
+//	  "blackLevel": 0.001,
+//	  "peakNits": 203,
+//	  "range": "video",
+//	  "output": {"dir": "out", "name": "{size}/{pattern}_{n}{variant}.{ext}", "overwrite": "skip"}
+//	}
+//
+// A size without patterns renders every pattern, and one without a name is
+// named after its size. Line counts may be given as a JSON list or in the
+// same string form as -n. Keys of "patterns" may be globs; exact names take
+// precedence over globs. Variants are registered before anything else, so
+// they can be used anywhere a pattern name can.
+type jobFile struct {
+	N        countList             `json:"n"`
+	Sizes    []jobSize             `json:"sizes"`
+	Patterns map[string]jobPattern `json:"patterns"`
+	Variants map[string]jobVariant `json:"variants"`
+	Output   *jobOutput            `json:"output"`
+
+	// These are the job file forms of -transfer, -primaries,
+	// -color-space, -black-level and -peak.
+	Transfer   string   `json:"transfer"`
+	Primaries  string   `json:"primaries"`
+	ColorSpace string   `json:"colorSpace"`
+	BlackLevel *float64 `json:"blackLevel"`
+	PeakNits   *float64 `json:"peakNits"`
+
+	// Range and Excursions are the job file forms of -range and
+	// -excursions.
+	Range      string `json:"range"`
+	Excursions *bool  `json:"excursions"`
+}
+
+// jobOutput holds the job file equivalents of -out, -name, -overwrite,
+// -manifest, -format, -chroma, -matrix and -depth.
+// The flags win when both are given.
+type jobOutput struct {
+	Dir       string  `json:"dir"`
+	Name      string  `json:"name"`
+	Overwrite string  `json:"overwrite"`
+	Manifest  *string `json:"manifest"`
+	Format    string  `json:"format"`
+	Chroma    string  `json:"chroma"`
+	Matrix    string  `json:"matrix"`
+	Depth     int     `json:"depth"`
+}
+
+type jobSize struct {
+	Name     string    `json:"name"`
+	Size     string    `json:"size"`
+	Patterns []string  `json:"patterns"`
+	N        countList `json:"n"`
+}
+
+type jobPattern struct {
+	N      countList             `json:"n"`
+	Params map[string]paramValue `json:"params"`
+}
+
+// jobVariant registers a new pattern that renders like base with some
+// parameter defaults changed.
+type jobVariant struct {
+	Base        string                `json:"base"`
+	Description string                `json:"description"`
+	Params      map[string]paramValue `json:"params"`
+}
+
+type countList []int
+
+func (c *countList) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		counts, err := parseCounts(s)
+		if err != nil {
+			return err
+		}
+		*c = counts
+		return nil
+	}
+
+	var counts []int
+	if err := json.Unmarshal(b, &counts); err != nil {
+		return fmt.Errorf("bad line counts %s", b)
+	}
+	for _, n := range counts {
+		if n < 0 {
+			return fmt.Errorf("bad count %d", n)
+		}
+	}
+	*c = counts
+	return nil
+}
+
+func loadJob(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var job jobFile
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&job); err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+
+	if len(job.Sizes) == 0 {
+		return fmt.Errorf("%s: no sizes", name)
+	}
+	if job.N != nil {
+		lineCountList = job.N
+	}
+
+	variants := make([]string, 0, len(job.Variants))
+	for key := range job.Variants {
+		variants = append(variants, key)
+	}
+	sort.Strings(variants)
+	for _, key := range variants {
+		v := job.Variants[key]
+		if err := addVariant(key, v.Base, v.Description, v.Params); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+
+	var sets sizeList
+	for _, js := range job.Sizes {
+		spec := js.Size
+		if js.Name != "" {
+			spec = js.Name + "=" + js.Size
+		}
+		if err := sets.Set(spec); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		if err := checkPatterns(js.Patterns); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+
+		set := &sets[len(sets)-1]
+		set.patterns = selectPatterns(registry, js.Patterns)
+		set.lineCounts = js.N
+	}
+	renderSets = sets
+
+	keys := make([]string, 0, len(job.Patterns))
+	for key := range job.Patterns {
+		if err := checkPatterns([]string{key}); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		keys = append(keys, key)
+	}
+	// Globs go first so that later exact names override them.
+	sort.Slice(keys, func(i, j int) bool {
+		gi := strings.ContainsAny(keys[i], "*?[\\")
+		gj := strings.ContainsAny(keys[j], "*?[\\")
+		if gi != gj {
+			return gi
+		}
+		return keys[i] < keys[j]
+	})
+	var rules []paramRule
+	for _, key := range keys {
+		jp := job.Patterns[key]
+		if jp.N != nil {
+			patternLineCounts = append(patternLineCounts, lineCountRule{pattern: key, counts: jp.N})
+		}
+
+		paramNames := make([]string, 0, len(jp.Params))
+		for param := range jp.Params {
+			paramNames = append(paramNames, param)
+		}
+		sort.Strings(paramNames)
+		for _, param := range paramNames {
+			rules = append(rules, paramRule{pattern: key, name: param, value: string(jp.Params[param])})
+		}
+	}
+	if err := checkParamRules(rules); err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	paramRules = append(paramRules, rules...)
+
+	if job.Transfer != "" && !flagSet("transfer") {
+		if err := (transferFlag{}).Set(job.Transfer); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	if job.Primaries != "" && !flagSet("primaries") {
+		if err := (colorSpaceFlag{&outputPrimaries}).Set(job.Primaries); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	if job.ColorSpace != "" && !flagSet("color-space") {
+		if err := (colorSpaceFlag{&inputSpace}).Set(job.ColorSpace); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	if job.BlackLevel != nil && !flagSet("black-level") {
+		blackLevel = *job.BlackLevel
+	}
+	if job.PeakNits != nil && !flagSet("peak") {
+		peakNits = *job.PeakNits
+	}
+	if job.Range != "" && !flagSet("range") {
+		if err := rangeFlag.Set(job.Range); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	if job.Excursions != nil && !flagSet("excursions") {
+		excursions = *job.Excursions
+	}
+
+	if out := job.Output; out != nil {
+		if out.Dir != "" && !flagSet("out") {
+			outDir = out.Dir
+		}
+		if out.Name != "" && !flagSet("name") {
+			nameTemplate = out.Name
+		}
+		if out.Manifest != nil && !flagSet("manifest") {
+			manifestName = *out.Manifest
+		}
+		if out.Overwrite != "" && !flagSet("overwrite") {
+			if err := overwrite.Set(out.Overwrite); err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+		}
+		if out.Format != "" && !flagSet("format") {
+			if err := formatFlag.Set(out.Format); err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+		}
+		if out.Chroma != "" && !flagSet("chroma") {
+			if err := chromaFlag.Set(out.Chroma); err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+		}
+		if out.Matrix != "" && !flagSet("matrix") {
+			if err := matrixFlag.Set(out.Matrix); err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+		}
+		if out.Depth != 0 && !flagSet("depth") {
+			yuvDepth = out.Depth
+		}
+	}
+
+	return nil
+}
+
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
+}
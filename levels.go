@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+)
+
+// codeSignal returns the signal level of a code value at the given bit
+// depth in videoRange, so that quantize gives back the same code.
+func codeSignal(code, bits int) float64 {
+	black, white, _, _ := codeLevels(bits)
+	return (float64(code) - black) / (white - black)
+}
+
+func intRange(lo, hi int) []int {
+	var r []int
+	for i := lo; i <= hi; i++ {
+		r = append(r, i)
+	}
+	return r
+}
+
+// pluge renders a picture line-up signal after ITU-R BT.814 and the bottom
+// row of the RP 219 bars: bars at -n%, +n% and +2n% of the signal, with
+// black between them, on a black field.
+func pluge(s image.Point, n int, _ params) image.Image {
+	img := newSignalImage(s)
+	step := float64(n) / 100
+
+	y0 := int(math.Round(float64(s.Y) / 4))
+	y1 := int(math.Round(float64(s.Y) * 3 / 4))
+	fillBars(img, y0, y1, []barSpan{
+		{1.0 / 4, signalGray(0)},
+		{1.0 / 10, signalGray(-step)},
+		{1.0 / 10, signalGray(0)},
+		{1.0 / 10, signalGray(step)},
+		{1.0 / 10, signalGray(0)},
+		{1.0 / 10, signalGray(2 * step)},
+		{1.0 / 4, signalGray(0)},
+	})
+	return img
+}
+
+// checkCodes makes sure the codes of a codePatches pattern fit in n bits.
+// Codes that fit but that the output range clips are left to warnClipped.
+func checkCodes(n int, p params) error {
+	for _, c := range p.List("codes") {
+		if c >= 1<<n {
+			return fmt.Errorf("code %d does not fit in %d bits", c, n)
+		}
+	}
+	return nil
+}
+
+// codePatches returns a renderer for a grid of patches at the code values
+// given by the codes parameter, with n the bit depth, each labeled with its
+// code value. The gaps between them are at the signal level bg.
+func codePatches(bg float64) imageFunc {
+	return func(s image.Point, n int, p params) image.Image {
+		codes := p.List("codes")
+		img := newSignalImage(s)
+		img.fill(img.rect, signalGray(bg))
+
+		// Choose the number of columns that makes the patches closest to
+		// square.
+		cols := max(int(math.Round(math.Sqrt(float64(len(codes)*s.X)/float64(s.Y)))), 1)
+		rows := (len(codes) + cols - 1) / cols
+		cellW := float64(s.X) / float64(cols)
+		cellH := float64(s.Y) / float64(rows)
+		gap := math.Min(cellW, cellH) / 10
+
+		var labels []textLabel
+		for i, c := range codes {
+			x := float64(i%cols) * cellW
+			y := float64(i/cols) * cellH
+			r := image.Rect(int(math.Round(x+gap/2)), int(math.Round(y+gap/2)),
+				int(math.Round(x+cellW-gap/2)), int(math.Round(y+cellH-gap/2)))
+			img.fill(r, signalGray(codeSignal(c, n)))
+			labels = append(labels, textLabel{text: strconv.Itoa(c), x: x + cellW/2, y: y + cellH/2})
+		}
+		img.drawLabels(labels, math.Min(cellW, cellH)/5, contrastInk)
+		return img
+	}
+}
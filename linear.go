@@ -0,0 +1,74 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// linearImage is rendered by patterns defined in light. Its values are
+// linear in the output primaries, with 1 for white, and are kept in
+// floating point until encodeLinear applies outputTransfer, so that steep
+// transfers such as PQ and gamma 2.4 keep every level near black.
+type linearImage struct {
+	pix  []float32
+	rect image.Rectangle
+}
+
+func newLinearImage(r image.Rectangle) *linearImage {
+	return &linearImage{
+		pix:  make([]float32, 3*r.Dx()*r.Dy()),
+		rect: r,
+	}
+}
+
+func (img *linearImage) ColorModel() color.Model { return color.RGBA64Model }
+
+func (img *linearImage) Bounds() image.Rectangle { return img.rect }
+
+// At returns the linear value at x, y clipped to 16 bits.
+func (img *linearImage) At(x, y int) color.Color {
+	v := img.rgb(x, y)
+	return color.RGBA64{R: signalLevel(v[0]), G: signalLevel(v[1]), B: signalLevel(v[2]), A: 65535}
+}
+
+func (img *linearImage) rgb(x, y int) [3]float64 {
+	i := 3 * ((y-img.rect.Min.Y)*img.rect.Dx() + x - img.rect.Min.X)
+	return [3]float64{float64(img.pix[i]), float64(img.pix[i+1]), float64(img.pix[i+2])}
+}
+
+func (img *linearImage) set(x, y int, c [3]float64) {
+	i := 3 * ((y-img.rect.Min.Y)*img.rect.Dx() + x - img.rect.Min.X)
+	img.pix[i], img.pix[i+1], img.pix[i+2] = float32(c[0]), float32(c[1]), float32(c[2])
+}
+
+func (img *linearImage) fill(r image.Rectangle, c [3]float64) {
+	r = r.Intersect(img.rect)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			img.set(x, y, c)
+		}
+	}
+}
+
+// encodeLinear encodes img with outputTransfer into a signal image, clipping
+// it to black and white first. Runs of the same value, which flat areas are
+// made of, are encoded once.
+func encodeLinear(img *linearImage) *signalImage {
+	out := &signalImage{pix: make([]float32, len(img.pix)), rect: img.rect}
+	last, encoded := float32(math.NaN()), float32(0)
+	for i, v := range img.pix {
+		if v != last {
+			last = v
+			encoded = float32(outputTransfer.encode(math.Min(math.Max(float64(v), 0), 1)))
+		}
+		out.pix[i] = encoded
+	}
+	return out
+}
+
+// gray maps a wave from -1 to 1 onto a linear gray from black to white.
+func gray(z float64) [3]float64 {
+	v := (z + 1) / 2
+	return [3]float64{v, v, v}
+}
@@ -5,112 +5,254 @@ import (
 	"fmt"
 	"image"
 	"image/color"
-	"image/draw"
-	"image/png"
 	"log"
 	"math"
 	"os"
-	"reflect"
+	"path"
 	"runtime"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 
 	"github.com/fogleman/gg"
 )
 
-type imageFunc func(image.Point, int) (image.Image, bool)
+type imageFunc func(image.Point, int, params) image.Image
 type renderSet struct {
 	name       string
 	size       image.Point
-	imageFuncs []imageFunc
+	patterns   []*pattern
+	lineCounts []int
 }
 
 var lineCountList = []int{2, 5, 10, 30, 60, 120, 480}
-var renderSets = []renderSet{
-	//{"tv", image.Point{3840, 2160}, imageFuncs},
-	{name: "tvx2", size: image.Point{X: 3840 * 2, Y: 2160 * 2}, imageFuncs: imageFuncs},
-	//{"proj", image.Point{3840, 2400}, imageFuncs},
-}
-
-var imageFuncs = []imageFunc{
-	jailWhite,
-	jailBlack,
-	jailDark,
-	jailMid,
-	jailCheck,
-	check,
-	radial,
-	rings,
-	ringFade,
-	wavy,
-	radialWave,
-	ringWave,
-	stripesh,
-	stripesv,
-	stripesdl,
-	stripesdr,
-	polkaDot,
-	polkaDark,
-	polkaMid,
-	field,
-	radialWedge,
-	radialWedgeOffsetX,
-	radialWedgeOffsetY,
-	diamond,
-	crosshatch,
-	honeycomb,
-	ss,
-	squareWave,
+
+// patternLineCounts overrides lineCountList for patterns whose names match
+// the key, which may be a glob. Later rules win over earlier ones.
+var patternLineCounts []lineCountRule
+
+type lineCountRule struct {
+	pattern string
+	counts  []int
 }
 
-var (
-	sRGBLUT        []uint16
-	inversesRGBLUT []uint16
-	gamma22LUT     []uint16
-	linearLUT      []uint16
-)
+// lineCountsFor returns the counts to render p at in set. A pattern's own
+// default counts win over the global and per-size lists, which are line
+// counts it has no use for, but not over rules naming it.
+func lineCountsFor(set renderSet, p *pattern) []int {
+	counts := lineCountList
+	if set.lineCounts != nil {
+		counts = set.lineCounts
+	}
+	if p.counts != nil {
+		counts = p.counts
+	}
+	for _, rule := range patternLineCounts {
+		if ok, _ := path.Match(rule.pattern, p.name); ok {
+			counts = rule.counts
+		}
+	}
+	return counts
+}
 
-var (
-	black    = color.RGBA64{A: 65535}
-	darkGray = color.RGBA64{R: 16383, G: 16383, B: 16383, A: 65535}
-	midGray  = color.RGBA64{R: 32767, G: 32767, B: 32767, A: 65535}
-	white    = color.RGBA64{R: 65535, G: 65535, B: 65535, A: 65535}
-)
+// lineCountFlag collects -n values. A bare list replaces the global list,
+// while pattern=list sets the list for matching patterns only.
+type lineCountFlag struct {
+	global []int
+	rules  []lineCountRule
+}
 
-func field(s image.Point, n int) (image.Image, bool) {
-	ctx, _, _ := newCtx(s, color.Gray16{Y: uint16(n * 65535 / 480)})
-	return ctx.Image(), true
+func (f *lineCountFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return formatCounts(f.global)
 }
 
-func stripe(s image.Point, theta float64, intN int) image.Image {
-	ctx, _, long := newCtx(s, white)
-	ctx.Rotate(gg.Radians(theta))
-	ctx.SetColor(black)
+func (f *lineCountFlag) Set(v string) error {
+	pat, list, perPattern := strings.Cut(v, "=")
+	if !perPattern {
+		list = v
+	}
 
-	n := float64(intN)
-	f := long / n
-	for x := -n; x < n; x += 2 {
-		ctx.DrawRectangle(x*f, -long, f, long*2)
-		ctx.Fill()
+	counts, err := parseCounts(list)
+	if err != nil {
+		return err
+	}
+
+	if !perPattern {
+		f.global = counts
+		return nil
 	}
+	if _, err := path.Match(pat, ""); err != nil || pat == "" {
+		return fmt.Errorf("bad pattern %q in %q", pat, v)
+	}
+	f.rules = append(f.rules, lineCountRule{pattern: pat, counts: counts})
+	return nil
+}
+
+// apply layers the command line counts over those from the defaults or a
+// job file. A global list from the command line also replaces any per-size
+// lists. It fails if a pattern=list rule matches no pattern, so it must run
+// after loadJob has registered any variants.
+func (f *lineCountFlag) apply() error {
+	for _, rule := range f.rules {
+		if err := checkPatterns([]string{rule.pattern}); err != nil {
+			return fmt.Errorf("-n %s: %v", rule.pattern, err)
+		}
+	}
+	if f.global != nil {
+		lineCountList = f.global
+		for i := range renderSets {
+			renderSets[i].lineCounts = nil
+		}
+	}
+	patternLineCounts = append(patternLineCounts, f.rules...)
+	return nil
+}
+
+// parseCounts parses a comma-separated list of counts, where each entry is
+// either a number, a range lo-hi, or a range with a step lo-hi:step.
+func parseCounts(list string) ([]int, error) {
+	var counts []int
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		rng, stepStr, stepped := strings.Cut(item, ":")
+		loStr, hiStr, isRange := strings.Cut(rng, "-")
+		if !isRange {
+			hiStr = loStr
+		}
+
+		lo, err := strconv.Atoi(loStr)
+		if err != nil {
+			return nil, fmt.Errorf("bad count %q: %v", item, err)
+		}
+		hi, err := strconv.Atoi(hiStr)
+		if err != nil {
+			return nil, fmt.Errorf("bad count %q: %v", item, err)
+		}
+		step := 1
+		if stepped {
+			if step, err = strconv.Atoi(stepStr); err != nil || step <= 0 {
+				return nil, fmt.Errorf("bad step in %q", item)
+			}
+		}
+		if lo < 0 || hi < lo {
+			return nil, fmt.Errorf("bad count %q", item)
+		}
+
+		for n := lo; n <= hi; n += step {
+			counts = append(counts, n)
+		}
+	}
+	return counts, nil
+}
+
+func formatCounts(counts []int) string {
+	s := make([]string, len(counts))
+	for i, n := range counts {
+		s[i] = strconv.Itoa(n)
+	}
+	return strings.Join(s, ",")
+}
+
+var renderSets = []renderSet{
+	{name: "tvx2", size: sizePresets["tvx2"]},
+}
+
+var sizePresets = map[string]image.Point{
+	"tv":   {X: 3840, Y: 2160},
+	"tvx2": {X: 3840 * 2, Y: 2160 * 2},
+	"proj": {X: 3840, Y: 2400},
+}
 
-	return ctx.Image()
+// sizeList collects -size flags. Each value is a preset name, WxH, or
+// name=WxH; the name becomes the size prefix of the output files.
+type sizeList []renderSet
+
+func (l *sizeList) String() string {
+	var s []string
+	for _, set := range *l {
+		s = append(s, fmt.Sprintf("%s=%dx%d", set.name, set.size.X, set.size.Y))
+	}
+	return strings.Join(s, ",")
 }
 
-func stripesdl(s image.Point, n int) (image.Image, bool) {
-	return stripe(s, 45, n), false
+func (l *sizeList) Set(v string) error {
+	name, dims, named := strings.Cut(v, "=")
+	if !named {
+		dims = v
+	}
+
+	size, ok := sizePresets[dims]
+	if !ok {
+		var err error
+		size, err = parseSize(dims)
+		if err != nil {
+			return err
+		}
+	}
+	if name == "" {
+		return fmt.Errorf("empty size name in %q", v)
+	}
+
+	for _, set := range *l {
+		if set.name == name {
+			return fmt.Errorf("duplicate size name %q", name)
+		}
+	}
+	*l = append(*l, renderSet{name: name, size: size})
+	return nil
 }
 
-func stripesdr(s image.Point, n int) (image.Image, bool) {
-	return stripe(s, -45, n), false
+func parseSize(s string) (image.Point, error) {
+	var p image.Point
+	w, h, ok := strings.Cut(strings.ToLower(s), "x")
+	if !ok {
+		return p, fmt.Errorf("bad size %q: want WxH or one of the presets", s)
+	}
+
+	var err error
+	if p.X, err = strconv.Atoi(w); err != nil {
+		return p, fmt.Errorf("bad size %q: %v", s, err)
+	}
+	if p.Y, err = strconv.Atoi(h); err != nil {
+		return p, fmt.Errorf("bad size %q: %v", s, err)
+	}
+	if p.X <= 0 || p.Y <= 0 {
+		return p, fmt.Errorf("bad size %q: dimensions must be positive", s)
+	}
+	return p, nil
 }
 
-func stripesv(s image.Point, n int) (image.Image, bool) {
-	return stripe(s, 0, n), false
+var (
+	black     = color.RGBA64{A: 65535}
+	darkGray  = color.RGBA64{R: 16383, G: 16383, B: 16383, A: 65535}
+	midGray   = color.RGBA64{R: 32767, G: 32767, B: 32767, A: 65535}
+	lightGray = color.RGBA64{R: 40959, G: 40959, B: 40959, A: 65535}
+	white     = color.RGBA64{R: 65535, G: 65535, B: 65535, A: 65535}
+)
+
+func field(s image.Point, n int, p params) image.Image {
+	// Levels past white stay white.
+	levels := p.Int("levels")
+	level := float64(min(n, levels)) / float64(levels)
+	return newLinear(s, [3]float64{level, level, level})
 }
 
-func stripesh(s image.Point, n int) (image.Image, bool) {
-	return stripe(s, 90, n), false
+func stripes(s image.Point, intN int, p params) image.Image {
+	ctx, _, long := newMaskCtx(s)
+	ctx.Rotate(gg.Radians(p.Float("angle")))
+
+	n := float64(intN)
+	f := long / n
+	for x := -n; x < n; x += 2 {
+		ctx.DrawRectangle(x*f, -long, f, long*2)
+		ctx.Fill()
+	}
+
+	return paintMask(newLinear(s, p.RGB("bg")), ctx, p.RGB("fg"))
 }
 
 func checkCtx(ctx *gg.Context, intN int) {
@@ -137,17 +279,14 @@ func checkCtx(ctx *gg.Context, intN int) {
 	}
 }
 
-func check(s image.Point, intN int) (image.Image, bool) {
-	ctx, _, _ := newCtx(s, white)
-	ctx.SetColor(black)
-
+func check(s image.Point, intN int, p params) image.Image {
+	ctx, _, _ := newMaskCtx(s)
 	checkCtx(ctx, intN)
-
-	return ctx.Image(), false
+	return paintMask(newLinear(s, p.RGB("bg")), ctx, p.RGB("fg"))
 }
 
-func radial(s image.Point, numLines int) (image.Image, bool) {
-	pic, b, _ := newPallete(s, nil)
+func radial(s image.Point, numLines int, _ params) image.Image {
+	pic, b, _ := newPallete(s)
 
 	fsx := float64(s.X / 2)
 	fsy := float64(s.Y / 2)
@@ -165,15 +304,15 @@ func radial(s image.Point, numLines int) (image.Image, bool) {
 			r := math.Sqrt(fx*fx + fy2)
 			f := r * slope
 			z := math.Cos(r * f)
-			pic.Set(x, y, gray(z))
+			pic.set(x, y, gray(z))
 		}
 	}
 
-	return pic, true
+	return pic
 }
 
-func rings(s image.Point, n int) (image.Image, bool) {
-	pic, b, long := newPallete(s, nil)
+func rings(s image.Point, n int, _ params) image.Image {
+	pic, b, long := newPallete(s)
 
 	f := 2.0 * math.Pi / float64(long/n)
 
@@ -184,15 +323,15 @@ func rings(s image.Point, n int) (image.Image, bool) {
 			fx := float64(x)
 			r := math.Sqrt(fx*fx + fy2)
 			z := math.Cos(r * f)
-			pic.Set(x, y, gray(z))
+			pic.set(x, y, gray(z))
 		}
 	}
 
-	return pic, true
+	return pic
 }
 
-func ringFade(s image.Point, n int) (image.Image, bool) {
-	pic, b, _ := newPallete(s, nil)
+func ringFade(s image.Point, n int, _ params) image.Image {
+	pic, b, _ := newPallete(s)
 
 	fsx := float64(s.X / 2)
 	fsy := float64(s.Y / 2)
@@ -205,32 +344,32 @@ func ringFade(s image.Point, n int) (image.Image, bool) {
 		fy2 := fy * fy
 		for x := b.Min.X; x < b.Max.X; x += 1 {
 			if x == 0 && y == 0 {
-				pic.Set(x, y, color.Gray{Y: 255})
+				pic.set(x, y, gray(1))
 			} else {
 				fx := float64(x)
 				r := math.Sqrt(fx*fx+fy2) * f
 				z := math.Sin(r) / (r)
-				pic.Set(x, y, gray(z))
+				pic.set(x, y, gray(z))
 			}
 		}
 	}
 
-	return pic, false
+	return pic
 }
 
-func wavy(s image.Point, n int) (image.Image, bool) {
-	pic, b, long := newPallete(s, nil)
+func wavy(s image.Point, n int, _ params) image.Image {
+	pic, b, long := newPallete(s)
 
 	scale := math.Pi / (float64(long) / float64(n))
 	for y := b.Min.Y; y < b.Max.Y; y += 1 {
 		cy := math.Cos(float64(y) * scale)
 		for x := b.Min.X; x < b.Max.X; x += 1 {
 			z := (math.Cos(float64(x)*scale) + cy) / 2.0
-			pic.Set(x, y, gray(z))
+			pic.set(x, y, gray(z))
 		}
 	}
 
-	return pic, true
+	return pic
 }
 
 func addJail(ctx *gg.Context, div float64, maxLineWidth float64) {
@@ -261,62 +400,39 @@ func addJail(ctx *gg.Context, div float64, maxLineWidth float64) {
 	}
 }
 
-func jailCheck(s image.Point, n int) (image.Image, bool) {
-	ctx, _, _ := newCtx(s, white)
+func jailCheck(s image.Point, n int, p params) image.Image {
+	checks, _, _ := newMaskCtx(s)
+	checkCtx(checks, n)
+	pic := paintMask(newLinear(s, p.RGB("bg")), checks, p.RGB("check"))
 
-	ctx.SetColor(gray(.25))
-	checkCtx(ctx, n)
-
-	ctx.SetColor(black)
-	addJail(ctx, float64(n), 5)
-	return ctx.Image(), false
+	ctx, _, _ := newMaskCtx(s)
+	addJail(ctx, float64(n), p.Float("maxWidth"))
+	return paintMask(pic, ctx, p.RGB("fg"))
 }
 
-func jailWhite(s image.Point, n int) (image.Image, bool) {
-	ctx, _, _ := newCtx(s, white)
-	ctx.SetColor(black)
-	addJail(ctx, float64(n), 5)
-	return ctx.Image(), false
-}
-func jailBlack(s image.Point, n int) (image.Image, bool) {
-	ctx, _, _ := newCtx(s, black)
-	ctx.SetColor(white)
-	addJail(ctx, float64(n), 5)
-	return ctx.Image(), false
-}
-func jailDark(s image.Point, n int) (image.Image, bool) {
-	ctx, _, _ := newCtx(s, darkGray)
-	ctx.SetColor(white)
-	addJail(ctx, float64(n), 5)
-	return ctx.Image(), false
-}
-func jailMid(s image.Point, n int) (image.Image, bool) {
-	ctx, _, _ := newCtx(s, midGray)
-	ctx.SetColor(white)
-	addJail(ctx, float64(n), 5)
-	return ctx.Image(), false
+func jail(s image.Point, n int, p params) image.Image {
+	ctx, _, _ := newMaskCtx(s)
+	addJail(ctx, float64(n), p.Float("maxWidth"))
+	return paintMask(newLinear(s, p.RGB("bg")), ctx, p.RGB("fg"))
 }
 
-func diamond(s image.Point, n int) (image.Image, bool) {
-	ctx, _, _ := newCtx(s, white)
-	ctx.SetColor(black)
+func diamond(s image.Point, n int, p params) image.Image {
+	ctx, _, _ := newMaskCtx(s)
 	ctx.Rotate(gg.Radians(45))
-	addJail(ctx, float64(n), 5)
-	return ctx.Image(), false
+	addJail(ctx, float64(n), p.Float("maxWidth"))
+	return paintMask(newLinear(s, p.RGB("bg")), ctx, p.RGB("fg"))
 }
 
-func crosshatch(s image.Point, n int) (image.Image, bool) {
-	ctx, _, _ := newCtx(s, white)
-	ctx.SetColor(black)
-	addJail(ctx, float64(n), 5)
+func crosshatch(s image.Point, n int, p params) image.Image {
+	ctx, _, _ := newMaskCtx(s)
+	addJail(ctx, float64(n), p.Float("maxWidth"))
 	ctx.Rotate(gg.Radians(45))
-	addJail(ctx, float64(n)/math.Sqrt2, 5)
-	return ctx.Image(), false
+	addJail(ctx, float64(n)/math.Sqrt2, p.Float("maxWidth"))
+	return paintMask(newLinear(s, p.RGB("bg")), ctx, p.RGB("fg"))
 }
 
-func honeycomb(s image.Point, nInt int) (image.Image, bool) {
-	ctx, b, l := newCtx(s, white)
-	ctx.SetColor(black)
+func honeycomb(s image.Point, nInt int, p params) image.Image {
+	ctx, b, l := newMaskCtx(s)
 
 	n := float64(nInt)
 	d := l / n
@@ -326,8 +442,8 @@ func honeycomb(s image.Point, nInt int) (image.Image, bool) {
 	wedge := side * math.Cos(math.Pi/3)
 
 	lineWidth := 0.06 * l / n
-	if lineWidth > 6 {
-		lineWidth = 6
+	if maxWidth := p.Float("maxWidth"); lineWidth > maxWidth {
+		lineWidth = maxWidth
 	}
 	ctx.SetLineWidth(lineWidth)
 
@@ -342,17 +458,16 @@ func honeycomb(s image.Point, nInt int) (image.Image, bool) {
 		}
 	}
 
-	return ctx.Image(), false
+	return paintMask(newLinear(s, p.RGB("bg")), ctx, p.RGB("fg"))
 }
 
-func ss(s image.Point, nInt int) (image.Image, bool) {
-	ctx, b, l := newCtx(s, white)
-	ctx.SetColor(black)
+func ss(s image.Point, nInt int, p params) image.Image {
+	ctx, b, l := newMaskCtx(s)
 
 	n := float64(nInt)
 	lineWidth := 0.06 * l / n
-	if lineWidth > 6 {
-		lineWidth = 6
+	if maxWidth := p.Float("maxWidth"); lineWidth > maxWidth {
+		lineWidth = maxWidth
 	}
 	ctx.SetLineWidth(lineWidth)
 
@@ -368,23 +483,25 @@ func ss(s image.Point, nInt int) (image.Image, bool) {
 		ctx.Stroke()
 	}
 
-	return ctx.Image(), false
+	return paintMask(newLinear(s, p.RGB("bg")), ctx, p.RGB("fg"))
 }
 
 func radialWedgeAngle(i, n int) float64 {
 	return math.Pi*2*float64(i)/float64(n) + math.Pi/4
 }
-func radialWedgeImpl(s image.Point, offsetX, offsetY float64, n int) (image.Image, bool) {
+
+// radialWedge centers the wedges at x and y, given as multiples of half the
+// image width and height.
+func radialWedge(s image.Point, n int, p params) image.Image {
 	n *= 2
 
-	ctx, b, l := newCtx(s, white)
+	ctx, b, l := newMaskCtx(s)
 
-	centerX := b.Max.X * offsetX
-	centerY := b.Max.Y * offsetY
+	centerX := b.Max.X * p.Float("x")
+	centerY := b.Max.Y * p.Float("y")
 	ctx.Translate(centerX, centerY)
 	r := math.Sqrt(centerX*centerX+centerY*centerY) + l
 
-	ctx.SetColor(black)
 	for i := 0; i < n; i += 2 {
 		ctx.DrawArc(0, 0, r, radialWedgeAngle(i, n), radialWedgeAngle(i+1, n))
 		ctx.LineTo(0, 0)
@@ -392,50 +509,41 @@ func radialWedgeImpl(s image.Point, offsetX, offsetY float64, n int) (image.Imag
 		ctx.Fill()
 	}
 
-	return ctx.Image(), false
-}
-func radialWedge(s image.Point, n int) (image.Image, bool) {
-	return radialWedgeImpl(s, 0, 0, n)
-}
-func radialWedgeOffsetX(s image.Point, n int) (image.Image, bool) {
-	return radialWedgeImpl(s, -1.5, 0, n)
-}
-func radialWedgeOffsetY(s image.Point, n int) (image.Image, bool) {
-	return radialWedgeImpl(s, 0, 1.5, n)
+	return paintMask(newLinear(s, p.RGB("bg")), ctx, p.RGB("fg"))
 }
 
-func radialWave(s image.Point, n int) (image.Image, bool) {
-	pic, b, _ := newPallete(s, nil)
+func radialWave(s image.Point, n int, _ params) image.Image {
+	pic, b, _ := newPallete(s)
 
 	fn := float64(n)
 	for y := b.Min.Y; y < b.Max.Y; y += 1 {
 		for x := b.Min.X; x < b.Max.X; x += 1 {
 			theta := math.Atan2(float64(y), float64(x))
 			z := math.Cos(math.Pi + theta*fn)
-			pic.Set(x, y, gray(z))
+			pic.set(x, y, gray(z))
 		}
 	}
 
-	return pic, true
+	return pic
 }
 
-func squareWave(s image.Point, n int) (image.Image, bool) {
+func squareWave(s image.Point, n int, _ params) image.Image {
 	const exp = 100.0
-	pic, b, _ := newPallete(s, nil)
+	pic, b, _ := newPallete(s)
 
 	for y := b.Min.Y; y < b.Max.Y; y += 1 {
 		zp := math.Cos(math.Pow(math.Abs(float64(y)), float64(n)/exp))
 		for x := b.Min.X; x < b.Max.X; x += 1 {
 			z := zp * math.Cos(math.Pow(math.Abs(float64(x)), float64(n)/100.0))
-			pic.Set(x, y, gray(z))
+			pic.set(x, y, gray(z))
 		}
 	}
 
-	return pic, true
+	return pic
 }
 
-func ringWave(s image.Point, n int) (image.Image, bool) {
-	pic, b, long := newPallete(s, nil)
+func ringWave(s image.Point, n int, _ params) image.Image {
+	pic, b, long := newPallete(s)
 
 	f := 2.0 * math.Pi / float64(long/n)
 	fn := float64(n)
@@ -450,31 +558,18 @@ func ringWave(s image.Point, n int) (image.Image, bool) {
 			theta := math.Atan2(fy, fx)
 
 			z := math.Cos(math.Pi+theta*fn) * math.Cos(r*f)
-			pic.Set(x, y, gray(z))
+			pic.set(x, y, gray(z))
 		}
 	}
 
-	return pic, true
+	return pic
 }
 
-func polkaDot(s image.Point, n int) (image.Image, bool) {
-	return doDot(s, n, black, white)
-}
-
-func polkaDark(s image.Point, n int) (image.Image, bool) {
-	return doDot(s, n, white, darkGray)
-}
-
-func polkaMid(s image.Point, n int) (image.Image, bool) {
-	return doDot(s, n, white, midGray)
-}
-
-func doDot(s image.Point, n int, foreground, background color.Color) (image.Image, bool) {
-	ctx, b, l := newCtx(s, background)
-	ctx.SetColor(foreground)
+func polkaDot(s image.Point, n int, p params) image.Image {
+	ctx, b, l := newMaskCtx(s)
 
 	long := int(l)
-	dotRadius := (long / n) / 5
+	dotRadius := int(float64(long/n) * p.Float("radius"))
 
 	longMin := int(b.Min.X)
 	if s.Y > s.X {
@@ -490,101 +585,309 @@ func doDot(s image.Point, n int, foreground, background color.Color) (image.Imag
 			ctx.Fill()
 		}
 	}
-	return ctx.Image(), false
+	return paintMask(newLinear(s, p.RGB("bg")), ctx, p.RGB("fg"))
 }
 
 func main() {
 	var wg sync.WaitGroup
 
+	var sizes sizeList
+	var counts lineCountFlag
+	jobFile := flag.String("job", "", "JSON job file describing the sizes, patterns and line counts to render")
+	patterns := flag.String("patterns", "", "comma-separated pattern names or globs to render, e.g. rings,jail* (default all)")
+	flag.Var(&sizes, "size", "render size as WxH, name=WxH or a preset (tv, tvx2, proj); may be repeated")
+	flag.Var(&counts, "n", "line counts as a list like 2,5,10 or 0-255:5, or pattern=list for matching patterns only; may be repeated (default "+formatCounts(lineCountList)+")")
+	flag.StringVar(&outDir, "out", outDir, "output directory")
+	flag.StringVar(&nameTemplate, "name", nameTemplate, "output file name template using {size}, {pattern}, {n}, {variant}, {transfer}, {primaries} and {ext}")
+	flag.Var(&overwrite, "overwrite", "what to do with existing files: overwrite, skip or fail")
+	var paramFlags paramFlag
+	flag.Var(&paramFlags, "param", "pattern parameter as pattern.name=value, where pattern may be a glob; may be repeated")
+	list := flag.Bool("list", false, "list the available patterns and their parameters, then exit")
+	flag.StringVar(&manifestName, "manifest", manifestName, "JSON manifest describing the files written, relative to -out; empty for none")
+	plan := flag.Bool("plan", false, "list the files that would be rendered, without rendering them")
+	flag.Var(transferFlag{}, "transfer", "output transfer function: srgb, gamma2.2, gamma2.4, linear, bt1886, pq or hlg")
+	flag.Var(colorSpaceFlag{&outputPrimaries}, "primaries", "output primaries: rec709, p3 or rec2020 (default rec2020 for pq and hlg, otherwise rec709)")
+	flag.Var(colorSpaceFlag{&inputSpace}, "color-space", "color space of pattern colors given without one: rec709, p3 or rec2020")
+	flag.Float64Var(&peakNits, "peak", peakNits, "luminance of pattern white in cd/m², for -transfer pq and hlg")
+	flag.Float64Var(&blackLevel, "black-level", blackLevel, "display black level as a fraction of white, for -transfer bt1886")
+	flag.Var(rangeFlag, "range", "code range: full, or video for 16-235 at 8 bits")
+	flag.BoolVar(&excursions, "excursions", excursions, "let video range signals go below black and above white")
+	flag.Var(formatFlag, "format", "output format: png, or yuv for raw planar Y′CbCr")
+	flag.Var(chromaFlag, "chroma", "chroma subsampling of yuv output: 444, 422 or 420")
+	flag.Var(matrixFlag, "matrix", "Y′CbCr matrix of yuv output: 601, 709 or 2020 (default 2020 for rec2020 primaries, otherwise 709)")
+	flag.IntVar(&yuvDepth, "depth", yuvDepth, "bits per sample of yuv output, from 8 to 16")
 	flag.Parse()
-	initLUTs()
 
+	if *jobFile != "" {
+		if err := loadJob(*jobFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *list {
+		listPatterns()
+		return
+	}
+	if blackLevel < 0 || blackLevel >= 1 {
+		log.Fatalf("black level %g must be at least 0 and less than 1", blackLevel)
+	}
+	if peakNits <= 0 || peakNits > 10000 {
+		log.Fatalf("peak luminance %g must be above 0 and at most 10000 cd/m²", peakNits)
+	}
+	if err := checkYUVDepth(yuvDepth); err != nil {
+		log.Fatal(err)
+	}
+	if outputPrimaries == nil {
+		outputPrimaries = rec709
+		if outputTransfer.hdr {
+			outputPrimaries = rec2020
+		}
+	}
+	if err := checkParamRules(paramFlags); err != nil {
+		log.Fatal(err)
+	}
+	paramRules = append(paramRules, paramFlags...)
+	if err := checkNameTemplate(nameTemplate); err != nil {
+		log.Fatal(err)
+	}
+	if len(sizes) > 0 {
+		renderSets = sizes
+	}
+	if err := counts.apply(); err != nil {
+		log.Fatal(err)
+	}
+
+	selected := splitPatterns(*patterns)
+	if err := checkPatterns(selected); err != nil {
+		log.Fatal(err)
+	}
+	for i := range renderSets {
+		set := &renderSets[i]
+		if set.patterns == nil {
+			set.patterns = registry
+		}
+		set.patterns = selectPatterns(set.patterns, selected)
+	}
+
+	jobs, err := planJobs(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	warnClipped(jobs)
+	if *plan {
+		printPlan(jobs)
+		return
+	}
+
+	var sum summary
 	queue := make(chan *imageJob)
 	for j := 0; j < runtime.NumCPU(); j++ {
 		wg.Add(1)
-		go worker(queue, &wg)
+		go worker(queue, &sum, &wg)
 	}
+	for _, job := range jobs {
+		queue <- job
+	}
+	close(queue)
 
+	wg.Wait()
+	if manifestName != "" {
+		if err := writeManifest(sum.entries); err != nil {
+			sum.fail(manifestPath(), err)
+		}
+	}
+	if !sum.report() {
+		os.Exit(1)
+	}
+}
+
+// planJobs expands renderSets into the list of jobs to run, restricted to
+// the set named only if it is not empty.
+func planJobs(only string) ([]*imageJob, error) {
+	var jobs []*imageJob
+	fileNames := make(map[string]bool)
 	for _, set := range renderSets {
-		if flag.Arg(0) != "" && set.name != flag.Arg(0) {
+		if only != "" && set.name != only {
 			continue
 		}
-		for _, numLines := range lineCountList {
-			for _, ifunc := range set.imageFuncs {
-				queue <- &imageJob{
-					imageFunc: ifunc,
-					imgSize:   set.size,
-					numLines:  numLines,
-					sizeName:  set.name,
+		counts := make([][]int, len(set.patterns))
+		values := make([]params, len(set.patterns))
+		for i, p := range set.patterns {
+			counts[i] = lineCountsFor(set, p)
+
+			var err error
+			if values[i], err = p.paramValues(); err != nil {
+				return nil, err
+			}
+			if err := p.checkCounts(counts[i], values[i]); err != nil {
+				return nil, err
+			}
+		}
+		for _, numLines := range countUnion(counts) {
+			for i, p := range set.patterns {
+				if !slices.Contains(counts[i], numLines) {
+					continue
+				}
+				fileName := makeName(set.name, p.name, numLines, "")
+				if fileNames[fileName] {
+					return nil, fmt.Errorf("name template %q gives %s for more than one target", nameTemplate, fileName)
+				}
+				fileNames[fileName] = true
+
+				job := &imageJob{
+					pattern:  p,
+					params:   values[i],
+					imgSize:  set.size,
+					numLines: numLines,
+					sizeName: set.name,
+					fileName: fileName,
 				}
+				if p.clamp {
+					job.clampName = makeName(set.name, p.name, numLines, "_clamp")
+				}
+				jobs = append(jobs, job)
 			}
 		}
 	}
-	close(queue)
+	return jobs, nil
+}
 
-	wg.Wait()
+// countUnion merges lists into one sorted list, so that jobs are still
+// queued smallest-count-first across patterns.
+func countUnion(lists [][]int) []int {
+	var out []int
+	for _, list := range lists {
+		out = append(out, list...)
+	}
+	slices.Sort(out)
+	return slices.Compact(out)
 }
 
 type imageJob struct {
-	imageFunc func(image.Point, int) (image.Image, bool)
-	imgSize   image.Point
-	numLines  int
-	sizeName  string
+	pattern  *pattern
+	params   params
+	imgSize  image.Point
+	numLines int
+	sizeName string
+
+	fileName  string
+	clampName string // empty if the pattern has no clamped variant
 }
 
-func worker(in chan *imageJob, wg *sync.WaitGroup) {
+func worker(in chan *imageJob, sum *summary, wg *sync.WaitGroup) {
 	defer wg.Done()
 	for job := range in {
-		oneTask(job.imageFunc, job.imgSize, job.numLines, job.sizeName)
+		oneTask(job, sum)
 	}
 }
 
-func oneTask(iFunc imageFunc, imgSize image.Point, numLines int, sizeName string) {
+// summary tallies the outcome of every output file across the workers.
+type summary struct {
+	sync.Mutex
+	entries []manifestEntry
+	skipped []string
+	failed  []string
+}
+
+func (sum *summary) wrote(entry manifestEntry) {
+	sum.Lock()
+	defer sum.Unlock()
+	fmt.Println(entry.File)
+	sum.entries = append(sum.entries, entry)
+}
+
+func (sum *summary) skip(name string) {
+	sum.Lock()
+	defer sum.Unlock()
+	fmt.Println("skipping", name)
+	sum.skipped = append(sum.skipped, name)
+}
+
+func (sum *summary) fail(name string, err error) {
+	sum.Lock()
+	defer sum.Unlock()
+	log.Printf("%s: %v", name, err)
+	sum.failed = append(sum.failed, fmt.Sprintf("%s: %v", name, err))
+}
 
-	funcAddr := reflect.ValueOf(iFunc).Pointer()
-	funcName := runtime.FuncForPC(funcAddr).Name()
-	if i := strings.LastIndex(funcName, "."); i >= 0 {
-		funcName = funcName[i+1:]
+// report prints the totals and any failures, and returns whether the run
+// succeeded.
+func (sum *summary) report() bool {
+	fmt.Printf("%d written, %d skipped, %d failed\n", len(sum.entries), len(sum.skipped), len(sum.failed))
+	for _, f := range sum.failed {
+		fmt.Fprintln(os.Stderr, "failed:", f)
 	}
+	return len(sum.failed) == 0
+}
 
-	img, shouldClamp := iFunc(imgSize, numLines)
-	//img, _ := imageFunc(imgSize, numLines)
+func oneTask(job *imageJob, sum *summary) {
+	writeMain, writeClamp := true, job.clampName != ""
+	if overwrite == overwriteSkip {
+		if exists(job.fileName) {
+			writeMain = false
+			sum.skip(job.fileName)
+		}
+		if writeClamp && exists(job.clampName) {
+			writeClamp = false
+			sum.skip(job.clampName)
+		}
+		if !writeMain && !writeClamp {
+			return
+		}
+	}
+
+	img, err := render(job)
+	if err != nil {
+		sum.fail(job.fileName, err)
+		return
+	}
 	if img == nil {
 		return
 	}
 
-	fileName := makeName(sizeName, funcName, numLines)
-
-	srgbImg := srgbConvert(img, sRGBLUT)
-	fmt.Println(fileName)
-	save(srgbImg, fileName)
+	if writeMain {
+		out := img
+		if !job.pattern.signal {
+			out = encodeLinear(img.(*linearImage))
+		}
+		if checksum, err := save(quantize(out), job.fileName, outputCICP()); err != nil {
+			sum.fail(job.fileName, err)
+		} else {
+			sum.wrote(newManifestEntry(job, job.fileName, out.Bounds().Size(), false, checksum))
+		}
+	}
 
-	if shouldClamp {
-		clamp := clamp(img)
-		fileName += "_clamp"
-		fmt.Println(fileName)
-		save(clamp, fileName)
+	if writeClamp {
+		clamp := clamp(img.(*linearImage))
+		if checksum, err := save(quantize(clamp), job.clampName, clampCICP()); err != nil {
+			sum.fail(job.clampName, err)
+		} else {
+			sum.wrote(newManifestEntry(job, job.clampName, clamp.Bounds().Size(), true, checksum))
+		}
 	}
 }
 
-func makeName(sizeName, typeName string, numLines int) string {
-	fileName := fmt.Sprintf("%s_%s_%03d", sizeName, typeName, numLines)
-	return fileName
+// render runs one pattern. Bad values of n and parameters are caught by
+// planJobs, but any panic is still turned into an error so that the rest of
+// the batch carries on.
+func render(job *imageJob) (img image.Image, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("rendering %s with n=%d: %v", job.pattern.name, job.numLines, r)
+		}
+	}()
+
+	return job.pattern.render(job.imgSize, job.numLines, job.params), nil
 }
 
-func newPallete(s image.Point, background color.Color) (pic *image.RGBA64, b image.Rectangle, l int) {
-	b = image.Rect(-s.X/2, -s.Y/2, s.X/2, s.Y/2)
-	pic = image.NewRGBA64(b)
+func newPallete(s image.Point) (pic *linearImage, b image.Rectangle, l int) {
+	b = image.Rect(-s.X/2, -s.Y/2, s.X-s.X/2, s.Y-s.Y/2)
+	pic = newLinearImage(b)
 	if s.X > s.Y {
 		l = s.X
 	} else {
 		l = s.Y
 	}
 
-	if background != nil {
-		draw.Draw(pic, b, &image.Uniform{C: background}, image.Point{}, draw.Src)
-	}
-
 	return
 }
 
@@ -628,31 +931,16 @@ func newCtx(s image.Point, background color.Color) (ctx *gg.Context, b floatRect
 	return
 }
 
-func save(i image.Image, name string) {
-	w, err := os.Create(name + ".png")
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer w.Close()
-
-	err = png.Encode(w, i)
-	if err != nil {
-		log.Fatal(err)
-	}
-}
-
-func gray(z float64) color.Color {
-	return color.Gray16{Y: uint16((z + 1.0) * 32767.5)}
-}
+// clampSigma is the blur applied to clamped variants to soften their edges.
+const clampSigma = 1.0
 
-func clamp(in image.Image) image.Image {
+func clamp(in *linearImage) image.Image {
 	b := in.Bounds()
 	out := image.NewRGBA64(b)
 
 	for y := b.Min.Y; y < b.Max.Y; y += 1 {
 		for x := b.Min.X; x < b.Max.X; x += 1 {
-			r, _, _, _ := in.At(x, y).RGBA()
-			if r > 0x7fff {
+			if in.rgb(x, y)[0] > 0.5 {
 				out.SetRGBA64(x, y, white)
 			} else {
 				out.SetRGBA64(x, y, black)
@@ -660,60 +948,5 @@ func clamp(in image.Image) image.Image {
 		}
 	}
 
-	return gaussianBlur(out, 1.0)
-}
-
-func srgbConvert(in image.Image, lut []uint16) image.Image {
-	b := in.Bounds()
-	out := image.NewRGBA64(b)
-
-	for y := b.Min.Y; y < b.Max.Y; y += 1 {
-		for x := b.Min.X; x < b.Max.X; x += 1 {
-			r, g, b, a := in.At(x, y).RGBA()
-			out.SetRGBA64(x, y, color.RGBA64{R: lut[r], G: lut[g], B: lut[b], A: uint16(a)})
-		}
-	}
-
-	return out
-}
-
-func initLUTs() {
-	a := 0.055
-	e := 1.0 / 2.4
-	a1 := a + 1.0
-	var csrgb, cl float64
-
-	sRGBLUT = make([]uint16, 65536)
-	for i := range sRGBLUT {
-		cl = float64(i) / 65535.0
-		if cl <= 0.0031308 {
-			csrgb = cl * 12.92
-		} else {
-			csrgb = a1*math.Pow(cl, e) - a
-		}
-		sRGBLUT[i] = uint16(csrgb * 65535.0)
-	}
-
-	inversesRGBLUT = make([]uint16, 65536)
-	for i := range inversesRGBLUT {
-		csrgb = float64(i) / 65535.0
-		if csrgb <= 0.04045 {
-			cl = csrgb / 12.92
-		} else {
-			cl = math.Pow((csrgb+a)/a1, 2.4)
-		}
-		inversesRGBLUT[i] = uint16(cl * 65535.0)
-	}
-
-	gamma := 2.2
-	gamma22LUT = make([]uint16, 65536)
-	for i := range gamma22LUT {
-		cl = float64(i) / 65535.0
-		gamma22LUT[i] = uint16(math.Pow(cl, gamma) * 65535.0)
-	}
-
-	linearLUT = make([]uint16, 65536)
-	for i := range linearLUT {
-		linearLUT[i] = uint16(i)
-	}
+	return gaussianBlur(out, clampSigma)
 }
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestParseCounts(t *testing.T) {
+	tests := []struct {
+		list string
+		want []int
+	}{
+		{"5", []int{5}},
+		{"2,5,10", []int{2, 5, 10}},
+		{" 1 , 2 ", []int{1, 2}},
+		{"3-5", []int{3, 4, 5}},
+		{"0-10:5", []int{0, 5, 10}},
+		{"0-9:4", []int{0, 4, 8}},
+		{"7-7", []int{7}},
+		{"1,4-6:2", []int{1, 4, 6}},
+	}
+	for _, tt := range tests {
+		got, err := parseCounts(tt.list)
+		if err != nil {
+			t.Errorf("parseCounts(%q): %v", tt.list, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("parseCounts(%q) = %v, want %v", tt.list, got, tt.want)
+		}
+	}
+
+	for _, list := range []string{"", "x", "1,", "-1", "5-3", "1-4:0", "1-4:-1", "1-4:x", "1-x"} {
+		if got, err := parseCounts(list); err == nil {
+			t.Errorf("parseCounts(%q) = %v, want an error", list, got)
+		}
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	// #808080 is sRGB encoded, so it decodes to well under half of white.
+	gray := srgbDecode(128.0 / 255)
+
+	tests := []struct {
+		s     string
+		space *colorSpace
+		rgb   [3]float64
+	}{
+		{"0.25", nil, [3]float64{0.25, 0.25, 0.25}},
+		{"1,0,0", nil, [3]float64{1, 0, 0}},
+		{" 0, 0.5 ,1", nil, [3]float64{0, 0.5, 1}},
+		{"#ff0000", nil, [3]float64{1, 0, 0}},
+		{"#FF00ff", nil, [3]float64{1, 0, 1}},
+		{"#808080", nil, [3]float64{gray, gray, gray}},
+		{"#ffff00000000", nil, [3]float64{1, 0, 0}},
+		{"#000000008080", nil, [3]float64{0, 0, srgbDecode(float64(0x8080) / 0xffff)}},
+		{"p3:1,0,0", p3, [3]float64{1, 0, 0}},
+		{"rec2020:0.5", rec2020, [3]float64{0.5, 0.5, 0.5}},
+		{"rec709:#00ff00", rec709, [3]float64{0, 1, 0}},
+	}
+	for _, tt := range tests {
+		c, err := parseColor(tt.s)
+		if err != nil {
+			t.Errorf("parseColor(%q): %v", tt.s, err)
+			continue
+		}
+		if c.space != tt.space {
+			t.Errorf("parseColor(%q) space = %v, want %v", tt.s, c.space, tt.space)
+		}
+		for i := range c.rgb {
+			if math.Abs(c.rgb[i]-tt.rgb[i]) > 1e-9 {
+				t.Errorf("parseColor(%q) = %v, want %v", tt.s, c.rgb, tt.rgb)
+				break
+			}
+		}
+	}
+
+	for _, s := range []string{"", "x", "1.5", "-0.1", "1,0", "1,0,0,0", "#fff", "#ff00000", "#gg0000", "nope:1", "p3:"} {
+		if c, err := parseColor(s); err == nil {
+			t.Errorf("parseColor(%q) = %v, want an error", s, c)
+		}
+	}
+}
+
+func TestEncodePNGCICP(t *testing.T) {
+	img := image.NewRGBA64(image.Rect(0, 0, 3, 2))
+
+	var plain bytes.Buffer
+	if err := encodePNG(&plain, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(plain.Bytes(), []byte("cICP")) {
+		t.Error("untagged PNG has a cICP chunk")
+	}
+
+	tests := []struct {
+		tags cicp
+		data []byte
+	}{
+		{cicp{primaries: 9, transfer: 16, fullRange: true}, []byte{9, 16, 0, 1}},
+		{cicp{primaries: 1, transfer: 13}, []byte{1, 13, 0, 0}},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := encodePNG(&buf, img, &tt.tags); err != nil {
+			t.Fatal(err)
+		}
+		b := buf.Bytes()
+
+		// The chunk must come straight after IHDR, which ends at byte 33,
+		// and before any image data.
+		want := pngChunk("cICP", tt.data)
+		if got := b[33 : 33+len(want)]; !bytes.Equal(got, want) {
+			t.Errorf("%+v: bytes after IHDR = % x, want % x", tt.tags, got, want)
+		}
+		if !bytes.Equal(b[:33], plain.Bytes()[:33]) {
+			t.Errorf("%+v: header changed", tt.tags)
+		}
+		if i := bytes.Index(b, []byte("IDAT")); i < 33+len(want) {
+			t.Errorf("%+v: IDAT at %d, before the end of cICP", tt.tags, i)
+		}
+
+		// The decoder checks the CRC of every chunk.
+		if _, err := png.Decode(bytes.NewReader(b)); err != nil {
+			t.Errorf("%+v: %v", tt.tags, err)
+		}
+	}
+}
+
+func TestOutputCICP(t *testing.T) {
+	oldTransfer, oldPrimaries := outputTransfer, outputPrimaries
+	t.Cleanup(func() { outputTransfer, outputPrimaries = oldTransfer, oldPrimaries })
+	setVideo(t, "full", "444", "709", 10)
+
+	tests := []struct {
+		transfer  *transfer
+		primaries *colorSpace
+		rng       string
+		want      *cicp
+	}{
+		{transfers[0], rec709, "full", nil},
+		{transfers[0], rec709, "video", &cicp{primaries: 1, transfer: 13}},
+		{transfers[0], p3, "full", &cicp{primaries: 12, transfer: 13, fullRange: true}},
+		{transfers[1], rec709, "full", &cicp{primaries: 1, transfer: 4, fullRange: true}},
+	}
+	for _, tt := range tests {
+		outputTransfer, outputPrimaries, videoRange = tt.transfer, tt.primaries, tt.rng
+		got := outputCICP()
+		if (got == nil) != (tt.want == nil) || got != nil && *got != *tt.want {
+			t.Errorf("%s %s %s: outputCICP() = %+v, want %+v", tt.transfer.name, tt.primaries.name, tt.rng, got, tt.want)
+		}
+	}
+}
+
+func TestEncodeLinearNearBlack(t *testing.T) {
+	old := outputTransfer
+	t.Cleanup(func() { outputTransfer = old })
+
+	// Every code up to top should be reached by a linear value below
+	// 1/65535, which a 16 bit linear image could not hold.
+	tests := []struct {
+		transfer string
+		bits     int
+		top      int
+	}{
+		{"pq", 10, 11},
+		{"hlg", 10, 8},
+		{"gamma2.4", 8, 2},
+		{"bt1886", 8, 2},
+	}
+	for _, tt := range tests {
+		if err := (transferFlag{}).Set(tt.transfer); err != nil {
+			t.Fatal(err)
+		}
+		const steps = 1000
+		img := newLinearImage(image.Rect(0, 0, steps, 1))
+		for x := 0; x < steps; x++ {
+			v := float64(x) / steps / 65535
+			img.set(x, 0, [3]float64{v, v, v})
+		}
+		enc := encodeLinear(img)
+
+		reached := make(map[int]bool)
+		for x := 0; x < steps; x++ {
+			reached[int(math.Round(enc.signal(x, 0)[0]*float64(int(1)<<tt.bits-1)))] = true
+		}
+		for code := 0; code <= tt.top; code++ {
+			if !reached[code] {
+				t.Errorf("%s: %d bit code %d is not reached below 1/65535", tt.transfer, tt.bits, code)
+			}
+		}
+	}
+}
+
+func TestPNGChunk(t *testing.T) {
+	// The IEND chunk, which is the same in every PNG.
+	want := []byte{0, 0, 0, 0, 'I', 'E', 'N', 'D', 0xae, 0x42, 0x60, 0x82}
+	if got := pngChunk("IEND", nil); !bytes.Equal(got, want) {
+		t.Errorf("pngChunk(IEND) = % x, want % x", got, want)
+	}
+}
+
+// setVideo sets the output coding globals for one test.
+func setVideo(t *testing.T, rng, chroma, matrix string, depth int) {
+	oldRange, oldExcursions, oldChroma, oldMatrix, oldDepth := videoRange, excursions, chromaFormat, matrixName, yuvDepth
+	t.Cleanup(func() {
+		videoRange, excursions, chromaFormat, matrixName, yuvDepth = oldRange, oldExcursions, oldChroma, oldMatrix, oldDepth
+	})
+	videoRange, excursions, chromaFormat, matrixName, yuvDepth = rng, false, chroma, matrix, depth
+}
+
+// signalRow returns a signal image one pixel high with the given colors.
+func signalRow(colors ...[3]float64) *signalImage {
+	img := newSignalImage(image.Pt(len(colors), 1))
+	for x, c := range colors {
+		img.set(x, 0, c)
+	}
+	return img
+}
+
+func TestEncodeYCbCrBars(t *testing.T) {
+	setVideo(t, "video", "444", "709", 8)
+
+	// 100% bars: white, yellow, cyan, green, magenta, red, blue and black.
+	img := signalRow(
+		[3]float64{1, 1, 1}, [3]float64{1, 1, 0}, [3]float64{0, 1, 1}, [3]float64{0, 1, 0},
+		[3]float64{1, 0, 1}, [3]float64{1, 0, 0}, [3]float64{0, 0, 1}, [3]float64{0, 0, 0},
+	)
+	var buf bytes.Buffer
+	if err := encodeYCbCr(&buf, quantize(img)); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []byte{
+		235, 219, 188, 173, 78, 63, 32, 16, // Y′
+		128, 16, 154, 42, 214, 102, 240, 128, // Cb
+		128, 138, 16, 26, 230, 240, 118, 128, // Cr
+	}
+	if got := buf.Bytes(); !bytes.Equal(got, want) {
+		t.Errorf("got\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestEncodeYCbCrSubsampling(t *testing.T) {
+	// Red and blue side by side share one chroma sample under 4:2:2.
+	setVideo(t, "video", "422", "709", 8)
+	var buf bytes.Buffer
+	if err := encodeYCbCr(&buf, quantize(signalRow([3]float64{1, 0, 0}, [3]float64{0, 0, 1}))); err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{63, 32, 171, 179}; !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("4:2:2 red and blue = %v, want %v", buf.Bytes(), want)
+	}
+
+	// A 3x3 white frame at 10 bits has 9 luma samples and 2x2 of each
+	// chroma component under 4:2:0, two bytes each, little endian.
+	setVideo(t, "full", "420", "709", 10)
+	img := newSignalImage(image.Pt(3, 3))
+	img.fill(img.rect, [3]float64{1, 1, 1})
+	buf.Reset()
+	if err := encodeYCbCr(&buf, quantize(img)); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	if len(b) != (9+2*4)*2 {
+		t.Fatalf("4:2:0 3x3 frame is %d bytes, want %d", len(b), (9+2*4)*2)
+	}
+	if b[0] != 0xff || b[1] != 0x03 {
+		t.Errorf("white luma = % x, want ff 03", b[:2])
+	}
+	if b[18] != 0x00 || b[19] != 0x02 {
+		t.Errorf("white Cb = % x, want 00 02", b[18:20])
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"time"
+)
+
+// version is normally filled in from the build info, but can be set with
+// -ldflags "-X main.version=...".
+var version = ""
+
+// manifestName is the manifest file, relative to outDir unless absolute.
+// An empty name disables the manifest.
+var manifestName = "manifest.json"
+
+// manifest describes every file written by a run, so that analysis scripts
+// do not have to recover the details from file names.
+type manifest struct {
+	Program string          `json:"program"`
+	Version string          `json:"version"`
+	Created time.Time       `json:"created"`
+	Files   []manifestEntry `json:"files"`
+}
+
+type manifestEntry struct {
+	File    string            `json:"file"` // relative to the manifest
+	Pattern string            `json:"pattern"`
+	Size    manifestSize      `json:"size"`
+	N       int               `json:"n"`
+	Params  map[string]string `json:"params,omitempty"`
+
+	// Transfer is the transfer function used to encode the file, or
+	// "none" for clamped variants, which are written as rendered.
+	Transfer   string  `json:"transfer"`
+	Primaries  string  `json:"primaries"`
+	BlackLevel float64 `json:"blackLevel,omitempty"`
+	PeakNits   float64 `json:"peakNits,omitempty"`
+	Range      string  `json:"range"`
+	Excursions bool    `json:"excursions,omitempty"`
+	Clamped    bool    `json:"clamped"`
+	BlurSigma  float64 `json:"blurSigma,omitempty"`
+
+	// YCbCr describes yuv files, and is nil for PNGs.
+	YCbCr  *manifestYCbCr `json:"ycbcr,omitempty"`
+	SHA256 string         `json:"sha256"`
+}
+
+type manifestYCbCr struct {
+	Chroma string `json:"chroma"`
+	Matrix string `json:"matrix"`
+	Depth  int    `json:"depth"`
+}
+
+type manifestSize struct {
+	Name   string `json:"name"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+func manifestPath() string {
+	if manifestName == "" || filepath.IsAbs(manifestName) {
+		return manifestName
+	}
+	return filepath.Join(outDir, manifestName)
+}
+
+// newManifestEntry describes a file written for job, whose image was size
+// pixels.
+func newManifestEntry(job *imageJob, fileName string, size image.Point, clamped bool, checksum string) manifestEntry {
+	e := manifestEntry{
+		File:       fileName,
+		Pattern:    job.pattern.name,
+		Size:       manifestSize{Name: job.sizeName, Width: size.X, Height: size.Y},
+		N:          job.numLines,
+		Transfer:   outputTransfer.name,
+		Primaries:  outputPrimaries.name,
+		Range:      videoRange,
+		Excursions: excursions && videoRange == "video",
+		Clamped:    clamped,
+		SHA256:     checksum,
+	}
+	if outputFormat == "yuv" {
+		e.YCbCr = &manifestYCbCr{Chroma: chromaFormat, Matrix: outputMatrix().name, Depth: yuvDepth}
+	}
+	if outputTransfer.name == "bt1886" {
+		e.BlackLevel = blackLevel
+	}
+	if outputTransfer.hdr {
+		e.PeakNits = peakNits
+	}
+	if clamped {
+		e.Transfer = "none"
+		e.BlackLevel = 0
+		e.PeakNits = 0
+		e.BlurSigma = clampSigma
+	}
+	if len(job.params) > 0 {
+		e.Params = make(map[string]string)
+		for k, v := range job.params {
+			e.Params[k] = formatParam(v)
+		}
+	}
+	return e
+}
+
+// writeManifest writes entries to the manifest. Entries from an earlier
+// manifest are kept for files that were not rewritten in this run, whether
+// skipped or failed, as long as they are still there. Nothing is written if
+// entries is empty, and with -overwrite fail an existing manifest is an
+// error.
+func writeManifest(entries []manifestEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	name := manifestPath()
+	dir := filepath.Dir(name)
+	rel := func(f string) string {
+		if r, err := filepath.Rel(dir, f); err == nil {
+			return r
+		}
+		return f
+	}
+
+	m := manifest{
+		Program: "makeTargets",
+		Version: programVersion(),
+		Created: time.Now().UTC().Truncate(time.Second),
+		Files:   []manifestEntry{},
+	}
+	written := make(map[string]bool)
+	for _, e := range entries {
+		e.File = rel(e.File)
+		written[e.File] = true
+		m.Files = append(m.Files, e)
+	}
+
+	if old, err := readManifest(name); err == nil {
+		for _, e := range old.Files {
+			if !written[e.File] && exists(filepath.Join(dir, e.File)) {
+				m.Files = append(m.Files, e)
+			}
+		}
+	}
+	sort.Slice(m.Files, func(i, j int) bool {
+		return m.Files[i].File < m.Files[j].File
+	})
+
+	return writeFile(name, overwrite == overwriteFail, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(m)
+	})
+}
+
+func readManifest(name string) (*manifest, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var m manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func programVersion() string {
+	if version != "" {
+		return version
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		return v
+	}
+
+	var rev, dirty string
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			rev = s.Value
+		case "vcs.modified":
+			if s.Value == "true" {
+				dirty = "-dirty"
+			}
+		}
+	}
+	if rev != "" {
+		return rev + dirty
+	}
+	return "devel"
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultNameTemplate reproduces the original size_pattern_NNN names.
+const defaultNameTemplate = "{size}_{pattern}_{n}{variant}.{ext}"
+
+var (
+	outDir       = "."
+	nameTemplate = defaultNameTemplate
+	overwrite    = overwriteAlways
+)
+
+type overwritePolicy int
+
+const (
+	overwriteAlways overwritePolicy = iota
+	overwriteSkip
+	overwriteFail
+)
+
+var overwriteNames = []string{"overwrite", "skip", "fail"}
+
+func (p *overwritePolicy) String() string {
+	return overwriteNames[*p]
+}
+
+func (p *overwritePolicy) Set(v string) error {
+	for i, name := range overwriteNames {
+		if v == name {
+			*p = overwritePolicy(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("bad overwrite policy %q: want one of %s", v, strings.Join(overwriteNames, ", "))
+}
+
+// checkNameTemplate rejects templates with unknown placeholders, or without
+// {variant}, which would let a clamped variant replace its original.
+func checkNameTemplate(t string) error {
+	if !strings.Contains(t, "{variant}") {
+		return fmt.Errorf("name template %q must contain {variant}", t)
+	}
+	if rest := nameReplacer("", "", 0, "").Replace(t); strings.ContainsAny(rest, "{}") {
+		return fmt.Errorf("name template %q has an unknown placeholder", t)
+	}
+	return nil
+}
+
+// makeName expands nameTemplate for one output file and places it in
+// outDir. The variant is empty for the main image, or a suffix like _clamp.
+func makeName(sizeName, typeName string, numLines int, variant string) string {
+	r := nameReplacer(sizeName, typeName, numLines, variant)
+	return filepath.Join(outDir, r.Replace(nameTemplate))
+}
+
+func nameReplacer(sizeName, typeName string, numLines int, variant string) *strings.Replacer {
+	return strings.NewReplacer(
+		"{size}", sizeName,
+		"{pattern}", typeName,
+		"{n}", fmt.Sprintf("%03d", numLines),
+		"{variant}", variant,
+		"{transfer}", outputTransfer.name,
+		"{primaries}", outputPrimaries.name,
+		"{ext}", outputFormat,
+	)
+}
+
+func exists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+// save writes i in outputFormat and returns the SHA-256 checksum of the
+// file. A PNG is tagged with tags, if given.
+func save(i image.Image, name string, tags *cicp) (checksum string, err error) {
+	if overwrite == overwriteFail && exists(name) {
+		return "", os.ErrExist
+	}
+
+	h := sha256.New()
+	err = writeFile(name, overwrite == overwriteFail, func(w io.Writer) error {
+		if outputFormat == "yuv" {
+			return encodeYCbCr(io.MultiWriter(w, h), i)
+		}
+		return encodePNG(io.MultiWriter(w, h), i, tags)
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeFile writes to a temporary file next to name, and moves it into
+// place only once it is complete, so a failure never leaves a truncated
+// file. With noClobber, an existing file is an error.
+func writeFile(name string, noClobber bool, write func(io.Writer) error) (err error) {
+	dir, base := filepath.Split(name)
+	dir = filepath.Clean(dir)
+	if err := os.MkdirAll(dir, 0o777); err != nil {
+		return err
+	}
+
+	w, err := os.CreateTemp(dir, "."+base+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(w.Name())
+		}
+	}()
+
+	err = write(w)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err = os.Chmod(w.Name(), 0o644); err != nil {
+		return err
+	}
+
+	if noClobber {
+		// Link fails if name already exists, where Rename would replace it.
+		if err = os.Link(w.Name(), name); errors.Is(err, os.ErrExist) {
+			err = os.ErrExist
+		}
+		if err != nil {
+			return err
+		}
+		return os.Remove(w.Name())
+	}
+	return os.Rename(w.Name(), name)
+}
+
+// cicp holds the ITU-T H.273 code points carried by a PNG cICP chunk.
+type cicp struct {
+	primaries byte
+	transfer  byte
+	matrix    byte
+	fullRange bool
+}
+
+// outputCICP returns the tags for files encoded with outputTransfer,
+// outputPrimaries and videoRange. Plain full range sRGB files are left
+// untagged, as that is what readers assume anyway.
+func outputCICP() *cicp {
+	fullRange := videoRange == "full"
+	if outputTransfer == transfers[0] && outputPrimaries == rec709 && fullRange {
+		return nil
+	}
+	return &cicp{primaries: outputPrimaries.cicp, transfer: outputTransfer.cicp, fullRange: fullRange}
+}
+
+// clampCICP returns the tags for clamped variants, which are left untagged
+// like plain sRGB files unless they are in video range.
+func clampCICP() *cicp {
+	if videoRange == "full" {
+		return nil
+	}
+	return &cicp{primaries: outputPrimaries.cicp, transfer: transfers[0].cicp}
+}
+
+// encodePNG writes i as a PNG with a cICP chunk describing tags, which must
+// come before the image data, inserted after the header.
+func encodePNG(w io.Writer, i image.Image, tags *cicp) error {
+	if tags == nil {
+		return png.Encode(w, i)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, i); err != nil {
+		return err
+	}
+	b := buf.Bytes()
+
+	// The 8 byte signature is followed by IHDR: length, type, 13 bytes of
+	// data and a CRC.
+	const headerEnd = 8 + 4 + 4 + 13 + 4
+	var fullRange byte
+	if tags.fullRange {
+		fullRange = 1
+	}
+	chunk := pngChunk("cICP", []byte{tags.primaries, tags.transfer, tags.matrix, fullRange})
+
+	for _, part := range [][]byte{b[:headerEnd], chunk, b[headerEnd:]} {
+		if _, err := w.Write(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func pngChunk(typ string, data []byte) []byte {
+	chunk := make([]byte, 8, 12+len(data))
+	binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+	copy(chunk[4:], typ)
+	chunk = append(chunk, data...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
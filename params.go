@@ -0,0 +1,340 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type paramKind int
+
+const (
+	// countParam is n, which is set with -n rather than -param.
+	countParam paramKind = iota
+	intParam
+	floatParam
+	colorParam
+	choiceParam
+
+	// listParam is a list of ints in the same form as -n.
+	listParam
+
+	// chartParam is a CGATS file of chart patches, read when it is parsed.
+	chartParam
+)
+
+// params holds the values of a pattern's parameters, keyed by name. Values
+// have the Go type of their kind: int, float64, linearColor, string, []int or
+// chart.
+type params map[string]any
+
+func (p params) Int(name string) int {
+	return p[name].(int)
+}
+
+func (p params) Float(name string) float64 {
+	return p[name].(float64)
+}
+
+// RGB returns a color parameter as linear components in outputPrimaries.
+func (p params) RGB(name string) [3]float64 {
+	return p[name].(linearColor).in(outputPrimaries)
+}
+
+func (p params) Choice(name string) string {
+	return p[name].(string)
+}
+
+func (p params) List(name string) []int {
+	return p[name].([]int)
+}
+
+func (p params) Chart(name string) chart {
+	return p[name].(chart)
+}
+
+// paramRule sets one parameter on every pattern matching a name or glob.
+type paramRule struct {
+	pattern string
+	name    string
+	value   string
+}
+
+// paramRules holds parameter settings from the job file followed by those
+// from the command line, so that later rules win.
+var paramRules []paramRule
+
+// paramFlag collects -param values of the form pattern.name=value.
+type paramFlag []paramRule
+
+func (f *paramFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	var s []string
+	for _, rule := range *f {
+		s = append(s, rule.pattern+"."+rule.name+"="+rule.value)
+	}
+	return strings.Join(s, " ")
+}
+
+func (f *paramFlag) Set(v string) error {
+	key, value, ok := strings.Cut(v, "=")
+	pat, name, dotted := strings.Cut(key, ".")
+	if !ok || !dotted || pat == "" || name == "" {
+		return fmt.Errorf("bad parameter %q: want pattern.name=value", v)
+	}
+	*f = append(*f, paramRule{pattern: pat, name: name, value: value})
+	return nil
+}
+
+// checkParamRules makes sure every rule names a parameter of at least one
+// pattern it matches, and that its value parses for all of them.
+func checkParamRules(rules []paramRule) error {
+	for _, rule := range rules {
+		if err := checkPatterns([]string{rule.pattern}); err != nil {
+			return err
+		}
+
+		found := false
+		for _, p := range registry {
+			if ok, _ := path.Match(rule.pattern, p.name); !ok {
+				continue
+			}
+			spec := p.param(rule.name)
+			if spec == nil {
+				continue
+			}
+			if _, err := spec.parse(rule.value); err != nil {
+				return fmt.Errorf("%s.%s: %v", p.name, rule.name, err)
+			}
+			found = true
+		}
+		if !found {
+			return fmt.Errorf("no pattern matching %q has a parameter %q", rule.pattern, rule.name)
+		}
+	}
+	return nil
+}
+
+func (p *pattern) param(name string) *paramSpec {
+	for i := range p.params {
+		if p.params[i].name == name {
+			return &p.params[i]
+		}
+	}
+	return nil
+}
+
+// paramValues returns the pattern's defaults with paramRules applied.
+func (p *pattern) paramValues() (params, error) {
+	values := make(params)
+	for _, spec := range p.params {
+		if spec.kind != countParam {
+			values[spec.name] = spec.def
+		}
+	}
+
+	for _, rule := range paramRules {
+		if ok, _ := path.Match(rule.pattern, p.name); !ok {
+			continue
+		}
+		spec := p.param(rule.name)
+		if spec == nil {
+			continue
+		}
+		v, err := spec.parse(rule.value)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %v", p.name, rule.name, err)
+		}
+		values[rule.name] = v
+	}
+	return values, nil
+}
+
+func (spec *paramSpec) parse(s string) (any, error) {
+	s = strings.TrimSpace(s)
+	switch spec.kind {
+	case intParam:
+		v, err := strconv.Atoi(s)
+		if err == nil {
+			err = spec.checkRange(float64(v))
+		}
+		return v, err
+	case floatParam:
+		v, err := strconv.ParseFloat(s, 64)
+		if err == nil {
+			err = spec.checkRange(v)
+		}
+		return v, err
+	case colorParam:
+		return parseColor(s)
+	case choiceParam:
+		if !slices.Contains(spec.choices, s) {
+			return nil, fmt.Errorf("bad value %q: want one of %s", s, strings.Join(spec.choices, ", "))
+		}
+		return s, nil
+	case listParam:
+		return parseCounts(s)
+	case chartParam:
+		return loadChart(s)
+	}
+	return nil, fmt.Errorf("n is set with -n")
+}
+
+// checkRange reports a count, int or float outside the limits of spec.
+func (spec *paramSpec) checkRange(v float64) error {
+	if v < spec.min || v > spec.max {
+		return fmt.Errorf("%g is out of range: want %s", v, spec.rangeText())
+	}
+	return nil
+}
+
+// rangeText describes the limits of spec, or is empty if there are none.
+func (spec *paramSpec) rangeText() string {
+	lo, hi := !math.IsInf(spec.min, -1), !math.IsInf(spec.max, 1)
+	switch {
+	case spec.kind != countParam && spec.kind != intParam && spec.kind != floatParam:
+		return ""
+	case lo && hi:
+		return fmt.Sprintf("from %g to %g", spec.min, spec.max)
+	case lo:
+		return fmt.Sprintf("at least %g", spec.min)
+	case hi:
+		return fmt.Sprintf("at most %g", spec.max)
+	}
+	return ""
+}
+
+// parseColor reads a linear-light gray level like 0.25 or an RGB triple like
+// 1,0,0, with components from 0 to 1, or a hex color like #ff0000 or
+// #ffff00000000, which is sRGB encoded. A prefix like p3: gives the color
+// space, which is otherwise inputSpace.
+func parseColor(s string) (linearColor, error) {
+	var c linearColor
+	if name, rest, ok := strings.Cut(s, ":"); ok {
+		cs, err := findColorSpace(name)
+		if err != nil {
+			return c, err
+		}
+		c.space, s = cs, rest
+	}
+
+	if hex, ok := strings.CutPrefix(s, "#"); ok {
+		digits := len(hex) / 3
+		if len(hex) != 6 && len(hex) != 12 {
+			return c, fmt.Errorf("bad color %q: want #rrggbb or #rrrrggggbbbb", s)
+		}
+		for i := range c.rgb {
+			v, err := strconv.ParseUint(hex[i*digits:(i+1)*digits], 16, 16)
+			if err != nil {
+				return c, fmt.Errorf("bad color %q: want #rrggbb or #rrrrggggbbbb", s)
+			}
+			c.rgb[i] = srgbDecode(float64(v) / float64(uint64(1)<<(4*digits)-1))
+		}
+		return c, nil
+	}
+
+	parts := strings.Split(s, ",")
+	if len(parts) != 1 && len(parts) != 3 {
+		return c, fmt.Errorf("bad color %q: want a gray level or r,g,b", s)
+	}
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || v < 0 || v > 1 {
+			return c, fmt.Errorf("bad color %q: components must be from 0 to 1", s)
+		}
+		c.rgb[i] = v
+	}
+	if len(parts) == 1 {
+		c.rgb[1], c.rgb[2] = c.rgb[0], c.rgb[0]
+	}
+	return c, nil
+}
+
+func formatParam(v any) string {
+	switch v := v.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case []int:
+		return formatCounts(v)
+	}
+	return fmt.Sprint(v)
+}
+
+// paramValue is a parameter value in a job file, which may be written as a
+// JSON string or number.
+type paramValue string
+
+func (v *paramValue) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*v = paramValue(s)
+		return nil
+	}
+
+	var f json.Number
+	if err := json.Unmarshal(b, &f); err != nil {
+		return fmt.Errorf("bad parameter value %s", b)
+	}
+	*v = paramValue(f)
+	return nil
+}
+
+// addVariant registers a copy of the pattern named base under a new name,
+// with some of its defaults replaced.
+func addVariant(name, base, description string, values map[string]paramValue) error {
+	if name == "" || strings.ContainsAny(name, "*?[\\.") {
+		return fmt.Errorf("bad variant name %q", name)
+	}
+	if findPattern(name) != nil {
+		return fmt.Errorf("variant %q: a pattern with that name already exists", name)
+	}
+	b := findPattern(base)
+	if b == nil {
+		return fmt.Errorf("variant %q: unknown base pattern %q", name, base)
+	}
+
+	p := *b
+	p.name = name
+	if description != "" {
+		p.description = description
+	}
+	p.params = append([]paramSpec(nil), b.params...)
+	for key, value := range values {
+		spec := p.param(key)
+		if spec == nil {
+			return fmt.Errorf("variant %q: %s has no parameter %q", name, base, key)
+		}
+		v, err := spec.parse(string(value))
+		if err != nil {
+			return fmt.Errorf("variant %q: %s: %v", name, key, err)
+		}
+		spec.def = v
+	}
+
+	registry = append(registry, &p)
+	return nil
+}
+
+// checkCounts makes sure every n in counts is in range for the pattern and
+// works with its parameter values.
+func (p *pattern) checkCounts(counts []int, values params) error {
+	spec := p.param("n")
+	for _, n := range counts {
+		if err := spec.checkRange(float64(n)); err != nil {
+			return fmt.Errorf("%s: n %v", p.name, err)
+		}
+		if p.check == nil {
+			continue
+		}
+		if err := p.check(n, values); err != nil {
+			return fmt.Errorf("%s: n=%d: %v", p.name, n, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import "image"
+
+// pixelGrid renders stripes or checks exactly n pixels wide, starting with
+// fg at the top left corner. Stripes alternate across the width if across
+// is set, down the height if down is set, and both make a checkerboard.
+func pixelGrid(across, down bool) imageFunc {
+	return func(s image.Point, n int, p params) image.Image {
+		pic := newLinear(s, p.RGB("bg"))
+		fg := p.RGB("fg")
+
+		for y := 0; y < s.Y; y += n {
+			for x := 0; x < s.X; x += n {
+				i := 0
+				if across {
+					i += x / n
+				}
+				if down {
+					i += y / n
+				}
+				if i%2 == 0 {
+					pic.fill(image.Rect(x, y, x+n, y+n), fg)
+				}
+			}
+		}
+		return pic
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"text/tabwriter"
+)
+
+// jobMemory estimates the peak memory used by one job. Patterns render into
+// 12 bytes per pixel, plus 4 for each gg coverage mask they hold, and
+// encodeLinear makes another 12 byte copy. A clamped variant needs the
+// source image plus four 8 byte images for clamp and its blur. Signal
+// patterns are written as they are. Video range adds an 8 byte copy.
+func jobMemory(job *imageJob) int64 {
+	pixels := int64(job.imgSize.X) * int64(job.imgSize.Y)
+	var mem int64
+	switch {
+	case job.pattern.signal:
+		mem = pixels * 12
+	case job.clampName != "":
+		mem = pixels * (12 + 8*4)
+	default:
+		mem = pixels * 12 * 2
+	}
+	mem += pixels * 4 * int64(job.pattern.masks)
+	if videoRange == "video" {
+		mem += pixels * 8
+	}
+	return mem
+}
+
+func printPlan(jobs []*imageJob) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "SIZE\tPIXELS\tPATTERN\tN\tFILE\tCLAMP\tMEMORY")
+
+	var files int
+	var peak int64
+	for _, job := range jobs {
+		clampName := "-"
+		files++
+		if job.clampName != "" {
+			clampName = job.clampName
+			files++
+		}
+
+		mem := jobMemory(job)
+		peak = max(peak, mem)
+		fmt.Fprintf(w, "%s\t%dx%d\t%s\t%d\t%s\t%s\t%s\n",
+			job.sizeName, job.imgSize.X, job.imgSize.Y, job.pattern.name, job.numLines,
+			job.fileName, clampName, formatBytes(mem))
+	}
+	w.Flush()
+
+	workers := min(runtime.NumCPU(), len(jobs))
+	fmt.Printf("%d jobs, %d files; about %s per job at most, %s for %d jobs at once\n",
+		len(jobs), files, formatBytes(peak), formatBytes(peak*int64(workers)), workers)
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"image"
+	"math"
+)
+
+// rampParams are the endpoints and spacing shared by steps and ramp.
+func rampParams(n string, more ...paramSpec) []paramSpec {
+	return append(nParam(n), append([]paramSpec{
+		colorSpec("from", "color at the start", black),
+		colorSpec("to", "color at the end", white),
+		choiceSpec("spacing", "even steps in CIE L* of each component, or in light", "lstar", "linear"),
+	}, more...)...)
+}
+
+// rampColor returns the linear color a fraction t of the way along the ramp
+// given by p.
+func rampColor(p params, t float64) [3]float64 {
+	from, to := p.RGB("from"), p.RGB("to")
+	if p.Choice("spacing") == "linear" {
+		return mixLinear(from, to, t)
+	}
+	var c [3]float64
+	for i := range c {
+		c[i] = lstarInverse(lstar(from[i]) + t*(lstar(to[i])-lstar(from[i])))
+	}
+	return c
+}
+
+// steps renders n bars running from the from color to the to color.
+func steps(s image.Point, n int, p params) image.Image {
+	pic := newLinearImage(image.Rect(0, 0, s.X, s.Y))
+	vertical := p.Choice("direction") == "v"
+	long := s.X
+	if vertical {
+		long = s.Y
+	}
+
+	for i := 0; i < n; i++ {
+		t := 0.0
+		if n > 1 {
+			t = float64(i) / float64(n-1)
+		}
+		r := image.Rect(long*i/n, 0, long*(i+1)/n, s.Y)
+		if vertical {
+			r = image.Rect(0, long*i/n, s.X, long*(i+1)/n)
+		}
+		pic.fill(r, rampColor(p, t))
+	}
+	return pic
+}
+
+// ramp renders n smooth ramps from the from color to the to color, across
+// the width or height, or out from the center to the corners.
+func ramp(s image.Point, n int, p params) image.Image {
+	pic := newLinearImage(image.Rect(0, 0, s.X, s.Y))
+	shape := p.Choice("shape")
+
+	// u runs from 0 to 1 over the ramp, and each of the n repeats of it
+	// covers (k, k+1] of u*n.
+	position := func(x, y int) float64 {
+		switch shape {
+		case "v":
+			return float64(y) / float64(max(s.Y-1, 1))
+		case "radial":
+			cx, cy := float64(s.X-1)/2, float64(s.Y-1)/2
+			return math.Hypot(float64(x)-cx, float64(y)-cy) / math.Max(math.Hypot(cx, cy), 1)
+		}
+		return float64(x) / float64(max(s.X-1, 1))
+	}
+
+	for y := 0; y < s.Y; y++ {
+		for x := 0; x < s.X; x++ {
+			u := position(x, y) * float64(n)
+			pic.set(x, y, rampColor(p, u-math.Max(math.Ceil(u)-1, 0)))
+		}
+	}
+	return pic
+}
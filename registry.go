@@ -0,0 +1,638 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"path"
+	"strings"
+)
+
+// pattern is an entry in the registry. Its name is used on the command line,
+// in job files and in output file names, so it must never change once
+// released.
+type pattern struct {
+	name        string
+	description string
+	tags        []string
+	params      []paramSpec
+	render      imageFunc
+
+	// clamp adds a variant thresholded to black and white and then
+	// slightly blurred, for continuous-tone patterns.
+	clamp bool
+
+	// signal patterns render a *signalImage, which is written without
+	// encoding.
+	signal bool
+
+	// belowBlack and aboveWhite patterns have levels below black or above
+	// white, which only video range with excursions can carry.
+	belowBlack bool
+	aboveWhite bool
+
+	// counts replaces the default line counts for patterns whose n is not
+	// a line count.
+	counts []int
+
+	// masks is the number of 4 byte per pixel gg coverage masks the
+	// pattern holds while it renders, for jobMemory.
+	masks int
+
+	// check reports n and parameter values that are each in range but do
+	// not work together.
+	check func(n int, p params) error
+}
+
+// paramSpec describes one parameter a pattern accepts, and its default.
+type paramSpec struct {
+	name        string
+	kind        paramKind
+	def         any
+	description string
+
+	// choices are the values a choiceParam may take.
+	choices []string
+
+	// min and max limit the values of counts, ints and floats.
+	min, max float64
+}
+
+// nParam is n, which is at least 1 unless nRange says otherwise.
+func nParam(description string) []paramSpec {
+	return nRange(description, 1, math.Inf(1))
+}
+
+func nRange(description string, min, max float64) []paramSpec {
+	return []paramSpec{{name: "n", kind: countParam, description: description, min: min, max: max}}
+}
+
+func colorSpec(name, description string, def color.RGBA64) paramSpec {
+	return paramSpec{name: name, kind: colorParam, def: newLinearColor(def), description: description}
+}
+
+func floatSpec(name, description string, def float64) paramSpec {
+	return paramSpec{name: name, kind: floatParam, def: def, description: description, min: math.Inf(-1), max: math.Inf(1)}
+}
+
+func intSpec(name, description string, def int) paramSpec {
+	return paramSpec{name: name, kind: intParam, def: def, description: description, min: math.Inf(-1), max: math.Inf(1)}
+}
+
+func listSpec(name, description string, def ...int) paramSpec {
+	return paramSpec{name: name, kind: listParam, def: def, description: description}
+}
+
+// chartSpec is a chart read from a CGATS file, by default the ColorChecker
+// Classic.
+func chartSpec(name, description string) paramSpec {
+	return paramSpec{name: name, kind: chartParam, def: chart{patches: colorCheckerClassic}, description: description}
+}
+
+// within limits an int or float parameter to values from min to max.
+func (spec paramSpec) within(min, max float64) paramSpec {
+	spec.min, spec.max = min, max
+	return spec
+}
+
+// choiceSpec is a parameter taking one of choices, the first of which is
+// the default.
+func choiceSpec(name, description string, choices ...string) paramSpec {
+	return paramSpec{name: name, kind: choiceParam, def: choices[0], description: description, choices: choices}
+}
+
+// bilevelParams gives the foreground and background colors of a pattern
+// drawn in two colors, followed by any others.
+func bilevelParams(n string, fg, bg color.RGBA64, more ...paramSpec) []paramSpec {
+	return append(nParam(n), append([]paramSpec{
+		colorSpec("fg", "foreground color", fg),
+		colorSpec("bg", "background color", bg),
+	}, more...)...)
+}
+
+func jailParams(fg, bg color.RGBA64) []paramSpec {
+	return bilevelParams("grid cells across the width", fg, bg,
+		floatSpec("maxWidth", "maximum line width in pixels", 5).within(0, math.Inf(1)),
+	)
+}
+
+func lineWidthParams(n string, maxWidth float64) []paramSpec {
+	return bilevelParams(n, black, white, floatSpec("maxWidth", "maximum line width in pixels", maxWidth).within(0, math.Inf(1)))
+}
+
+func stripeParams(angle float64) []paramSpec {
+	return bilevelParams("stripes across the long side", black, white,
+		floatSpec("angle", "stripe angle in degrees", angle),
+	)
+}
+
+func polkaParams(fg, bg color.RGBA64) []paramSpec {
+	return bilevelParams("dot spacings across the long side", fg, bg,
+		floatSpec("radius", "dot radius as a fraction of the spacing", 0.2).within(0, math.Inf(1)),
+	)
+}
+
+func wedgeParams(x, y float64) []paramSpec {
+	return bilevelParams("foreground wedges", black, white,
+		floatSpec("x", "center offset in half widths", x),
+		floatSpec("y", "center offset in half heights", y),
+	)
+}
+
+var registry = []*pattern{
+	{
+		name:        "jailWhite",
+		description: "black grid lines on white",
+		tags:        []string{"grid", "bilevel"},
+		params:      jailParams(black, white),
+		render:      jail,
+		masks:       1,
+	},
+	{
+		name:        "jailBlack",
+		description: "white grid lines on black",
+		tags:        []string{"grid", "bilevel"},
+		params:      jailParams(white, black),
+		render:      jail,
+		masks:       1,
+	},
+	{
+		name:        "jailDark",
+		description: "white grid lines on dark gray",
+		tags:        []string{"grid", "bilevel"},
+		params:      jailParams(white, darkGray),
+		render:      jail,
+		masks:       1,
+	},
+	{
+		name:        "jailMid",
+		description: "white grid lines on mid gray",
+		tags:        []string{"grid", "bilevel"},
+		params:      jailParams(white, midGray),
+		render:      jail,
+		masks:       1,
+	},
+	{
+		name:        "jailCheck",
+		description: "black grid lines over a gray and white checkerboard",
+		tags:        []string{"grid", "check"},
+		params: append(jailParams(black, white),
+			colorSpec("check", "color of the darker squares", lightGray),
+		),
+		render: jailCheck,
+		masks:  2,
+	},
+	{
+		name:        "check",
+		description: "black and white checkerboard",
+		tags:        []string{"check", "bilevel"},
+		params:      bilevelParams("squares across the long side", black, white),
+		render:      check,
+		masks:       1,
+	},
+	{
+		name:        "radial",
+		description: "circular chirp whose frequency rises with radius",
+		tags:        []string{"radial", "sinusoid", "chirp"},
+		params:      nParam("period in pixels at the corners"),
+		render:      radial,
+		clamp:       true,
+	},
+	{
+		name:        "rings",
+		description: "concentric sinusoidal rings of constant frequency",
+		tags:        []string{"radial", "sinusoid"},
+		params:      nParam("cycles across the long side"),
+		render:      rings,
+		clamp:       true,
+	},
+	{
+		name:        "ringFade",
+		description: "concentric rings fading out from the center as sin(r)/r",
+		tags:        []string{"radial", "sinusoid"},
+		params:      nParam("cycles from the center to the corners"),
+		render:      ringFade,
+	},
+	{
+		name:        "wavy",
+		description: "egg crate of horizontal and vertical sinusoids",
+		tags:        []string{"sinusoid"},
+		params:      nParam("half cycles across the long side"),
+		render:      wavy,
+		clamp:       true,
+	},
+	{
+		name:        "radialWave",
+		description: "sinusoid varying with angle around the center",
+		tags:        []string{"radial", "sinusoid"},
+		params:      nParam("cycles around the center"),
+		render:      radialWave,
+		clamp:       true,
+	},
+	{
+		name:        "ringWave",
+		description: "product of rings and radialWave",
+		tags:        []string{"radial", "sinusoid"},
+		params:      nParam("ring cycles across the long side and cycles around the center"),
+		render:      ringWave,
+		clamp:       true,
+	},
+	{
+		name:        "stripesh",
+		description: "horizontal black and white stripes",
+		tags:        []string{"stripes", "bilevel"},
+		params:      stripeParams(90),
+		render:      stripes,
+		masks:       1,
+	},
+	{
+		name:        "stripesv",
+		description: "vertical black and white stripes",
+		tags:        []string{"stripes", "bilevel"},
+		params:      stripeParams(0),
+		render:      stripes,
+		masks:       1,
+	},
+	{
+		name:        "pixelStripesh",
+		description: "horizontal stripes a whole number of pixels high",
+		tags:        []string{"stripes", "bilevel", "pixel"},
+		params:      bilevelParams("stripe height in pixels", black, white),
+		render:      pixelGrid(false, true),
+		counts:      []int{1, 2, 3},
+	},
+	{
+		name:        "pixelStripesv",
+		description: "vertical stripes a whole number of pixels wide",
+		tags:        []string{"stripes", "bilevel", "pixel"},
+		params:      bilevelParams("stripe width in pixels", black, white),
+		render:      pixelGrid(true, false),
+		counts:      []int{1, 2, 3},
+	},
+	{
+		name:        "pixelCheck",
+		description: "checkerboard of squares a whole number of pixels wide",
+		tags:        []string{"bilevel", "pixel"},
+		params:      bilevelParams("square size in pixels", black, white),
+		render:      pixelGrid(true, true),
+		counts:      []int{1, 2, 3},
+	},
+	{
+		name:        "stripesdl",
+		description: "black and white stripes at 45 degrees",
+		tags:        []string{"stripes", "bilevel"},
+		params:      stripeParams(45),
+		render:      stripes,
+		masks:       1,
+	},
+	{
+		name:        "stripesdr",
+		description: "black and white stripes at -45 degrees",
+		tags:        []string{"stripes", "bilevel"},
+		params:      stripeParams(-45),
+		render:      stripes,
+		masks:       1,
+	},
+	{
+		name:        "polkaDot",
+		description: "black dots on white",
+		tags:        []string{"dots", "bilevel"},
+		params:      polkaParams(black, white),
+		render:      polkaDot,
+		masks:       1,
+	},
+	{
+		name:        "polkaDark",
+		description: "white dots on dark gray",
+		tags:        []string{"dots", "bilevel"},
+		params:      polkaParams(white, darkGray),
+		render:      polkaDot,
+		masks:       1,
+	},
+	{
+		name:        "polkaMid",
+		description: "white dots on mid gray",
+		tags:        []string{"dots", "bilevel"},
+		params:      polkaParams(white, midGray),
+		render:      polkaDot,
+		masks:       1,
+	},
+	{
+		name:        "field",
+		description: "uniform gray field",
+		tags:        []string{"uniform"},
+		params:      append(nRange("linear gray level in steps of white/levels", 0, math.Inf(1)), intSpec("levels", "steps from black to white", 480).within(1, math.Inf(1))),
+		render:      field,
+		clamp:       true,
+	},
+	{
+		name:        "radialWedge",
+		description: "black and white wedges around the center",
+		tags:        []string{"radial", "wedge", "bilevel"},
+		params:      wedgeParams(0, 0),
+		render:      radialWedge,
+		masks:       1,
+	},
+	{
+		name:        "radialWedgeOffsetX",
+		description: "wedges centered far to the left of the image",
+		tags:        []string{"radial", "wedge", "bilevel"},
+		params:      wedgeParams(-1.5, 0),
+		render:      radialWedge,
+		masks:       1,
+	},
+	{
+		name:        "radialWedgeOffsetY",
+		description: "wedges centered far below the image",
+		tags:        []string{"radial", "wedge", "bilevel"},
+		params:      wedgeParams(0, 1.5),
+		render:      radialWedge,
+		masks:       1,
+	},
+	{
+		name:        "diamond",
+		description: "black grid lines on white, rotated 45 degrees",
+		tags:        []string{"grid", "bilevel"},
+		params:      lineWidthParams("grid cells across the width", 5),
+		render:      diamond,
+		masks:       1,
+	},
+	{
+		name:        "crosshatch",
+		description: "black grid lines on white with diagonals",
+		tags:        []string{"grid", "bilevel"},
+		params:      lineWidthParams("grid cells across the width", 5),
+		render:      crosshatch,
+		masks:       1,
+	},
+	{
+		name:        "honeycomb",
+		description: "black hexagon outlines on white",
+		tags:        []string{"grid", "bilevel"},
+		params:      lineWidthParams("hexagons across the long side", 6),
+		render:      honeycomb,
+		masks:       1,
+	},
+	{
+		name:        "ss",
+		description: "string art curves between the axes",
+		tags:        []string{"bilevel"},
+		params:      lineWidthParams("lines in each quadrant", 6),
+		render:      ss,
+		masks:       1,
+	},
+	{
+		name:        "squareWave",
+		description: "product of horizontal and vertical chirps",
+		tags:        []string{"sinusoid", "chirp"},
+		params:      nParam("chirp exponent in hundredths"),
+		render:      squareWave,
+		clamp:       true,
+	},
+	{
+		name:        "steps",
+		description: "gray step wedge",
+		tags:        []string{"gray", "ramp"},
+		params:      rampParams("steps", choiceSpec("direction", "steps across the width or down the height", "h", "v")),
+		render:      steps,
+		counts:      []int{11, 21},
+	},
+	{
+		name:        "ramp",
+		description: "smooth gray ramp",
+		tags:        []string{"gray", "ramp"},
+		params:      rampParams("ramps across the frame", choiceSpec("shape", "across the width, down the height or out from the center to the corners", "h", "v", "radial")),
+		render:      ramp,
+		counts:      []int{1},
+	},
+	{
+		name:        "zonePlate",
+		description: "Fresnel zone plate whose frequency rises linearly with radius",
+		tags:        []string{"sinusoid", "chirp"},
+		params: append(nRange("frame number, for sequences with kt", 0, math.Inf(1)),
+			floatSpec("kmax", "frequency at the ends of the long axis in cycles per pixel", 0.5),
+			floatSpec("phase", "phase at the center in degrees", 0),
+			floatSpec("kt", "phase advance per frame in degrees", 0),
+		),
+		render: zonePlate,
+		clamp:  true,
+		counts: []int{0},
+	},
+	{
+		name:        "siemensStar",
+		description: "antialiased Siemens star with an optional mask inside the Nyquist radius",
+		tags:        []string{"bilevel", "resolution"},
+		params: bilevelParams("foreground wedges", black, white,
+			choiceSpec("profile", "square wedges with exact coverage, or a sinusoid in angle", "square", "sine"),
+			choiceSpec("mask", "circle covering the center out to the Nyquist radius", "nyquist", "none"),
+			colorSpec("maskColor", "color of the mask", midGray),
+		),
+		render: siemensStar,
+		counts: []int{36, 72, 144},
+	},
+	{
+		name:        "slantedEdge",
+		description: "slanted squares for ISO 12233 edge MTF measurement",
+		tags:        []string{"resolution"},
+		params: append(nParam("squares across the width"),
+			floatSpec("angle", "rotation of the squares in degrees", 5),
+			floatSpec("contrast", "ratio of bg to the squares in linear light", 4).within(1, math.Inf(1)),
+			colorSpec("bg", "color around the squares", white),
+		),
+		render: slantedEdge,
+		counts: []int{1, 3},
+	},
+	{
+		name:        "geometry",
+		description: "frame edge, overscan markers, safe areas, circles and aspect ratio guides",
+		tags:        []string{"geometry"},
+		params: bilevelParams("line width in pixels", white, black,
+			colorSpec("guides", "color of the aspect ratio guides", midGray),
+		),
+		render: geometry,
+		masks:  1,
+		counts: []int{1, 2},
+	},
+	{
+		name:        "pluge",
+		description: "PLUGE bars at and around black",
+		tags:        []string{"levels", "video"},
+		params:      nRange("bar levels in percent: -n, +n and +2n", 1, 50),
+		render:      pluge,
+		signal:      true,
+		belowBlack:  true,
+		counts:      []int{2},
+	},
+	{
+		name:        "nearBlack",
+		description: "numbered patches at code values near black",
+		tags:        []string{"levels", "video"},
+		params:      append(nRange("bit depth of the code values", 8, 16), listSpec("codes", "code values of the patches", intRange(0, 24)...)),
+		render:      codePatches(0),
+		masks:       1,
+		signal:      true,
+		belowBlack:  true,
+		counts:      []int{8},
+		check:       checkCodes,
+	},
+	{
+		name:        "nearWhite",
+		description: "numbered patches at code values near white",
+		tags:        []string{"levels", "video"},
+		params:      append(nRange("bit depth of the code values", 8, 16), listSpec("codes", "code values of the patches", intRange(231, 255)...)),
+		render:      codePatches(1),
+		masks:       1,
+		signal:      true,
+		aboveWhite:  true,
+		counts:      []int{8},
+		check:       checkCodes,
+	},
+	{
+		name:        "chromaLines",
+		description: "colored lines on black, vertical above and horizontal below",
+		tags:        []string{"chroma", "video"},
+		params:      nParam("line width in pixels"),
+		render:      chromaLines,
+		signal:      true,
+		counts:      []int{1, 2},
+	},
+	{
+		name:        "chromaText",
+		description: "colored text on colored backgrounds",
+		tags:        []string{"chroma", "video"},
+		params:      nParam("text size in pixels"),
+		render:      chromaText,
+		masks:       1,
+		signal:      true,
+		counts:      []int{8, 12},
+	},
+	{
+		name:        "chromaColumns",
+		description: "alternating equal-luma colors, as columns above and rows below",
+		tags:        []string{"chroma", "video"},
+		params:      nParam("stripe width in pixels"),
+		render:      chromaColumns,
+		signal:      true,
+		counts:      []int{1},
+	},
+	{
+		name:        "colorChecker",
+		description: "ColorChecker Classic chart, or any chart read from a CGATS file",
+		tags:        []string{"color"},
+		params: append(nParam("patches in each row"),
+			colorSpec("bg", "background color", black),
+			chartSpec("data", "CGATS file of the chart's L*a*b* values under D50, such as the 140 patch ColorChecker SG; empty for the Classic"),
+			choiceSpec("labels", "patch labels", "names", "none"),
+		),
+		render: colorChecker,
+		masks:  1,
+		counts: []int{6},
+	},
+	{
+		name:        "barsEBU",
+		description: "EBU color bars, with the white bar at 100%",
+		tags:        []string{"bars", "video"},
+		params:      nRange("level of the colored bars in percent", 0, 100),
+		render:      ebuBars,
+		signal:      true,
+		counts:      []int{75, 100},
+	},
+	{
+		name:        "barsSMPTE",
+		description: "SMPTE RP 219 HD color bars with −I and +Q",
+		tags:        []string{"bars", "video"},
+		params:      nRange("level of the top row of bars in percent", 0, 100),
+		render:      hdBars(minusISignal, qSignal),
+		signal:      true,
+		belowBlack:  true,
+		counts:      []int{75},
+	},
+	{
+		name:        "barsARIB",
+		description: "ARIB STD-B28 HD color bars with 100% white and black in place of −I and +Q",
+		tags:        []string{"bars", "video"},
+		params:      nRange("level of the top row of bars in percent", 0, 100),
+		render:      hdBars(barColors[0], signalGray(0)),
+		signal:      true,
+		belowBlack:  true,
+		counts:      []int{75},
+	},
+}
+
+func findPattern(name string) *pattern {
+	for _, p := range registry {
+		if p.name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+func listPatterns() {
+	for _, p := range registry {
+		fmt.Printf("%s\t%s [%s]\n", p.name, p.description, strings.Join(p.tags, ","))
+		for _, spec := range p.params {
+			description := spec.description
+			if r := spec.rangeText(); r != "" {
+				description += ", " + r
+			}
+			if spec.kind == countParam && p.counts != nil {
+				fmt.Printf("\t%s: %s (default %s)\n", spec.name, description, formatCounts(p.counts))
+			} else if spec.kind == countParam {
+				fmt.Printf("\t%s: %s\n", spec.name, description)
+			} else if spec.kind == choiceParam {
+				fmt.Printf("\t%s: %s, one of %s (default %s)\n", spec.name, description, strings.Join(spec.choices, ", "), spec.def)
+			} else {
+				fmt.Printf("\t%s: %s (default %s)\n", spec.name, description, formatParam(spec.def))
+			}
+		}
+	}
+}
+
+func splitPatterns(list string) []string {
+	var pats []string
+	for _, pat := range strings.Split(list, ",") {
+		if pat = strings.TrimSpace(pat); pat != "" {
+			pats = append(pats, pat)
+		}
+	}
+	return pats
+}
+
+// checkPatterns reports an error for any name or glob in pats that is
+// malformed or does not match a registered pattern.
+func checkPatterns(pats []string) error {
+	for _, pat := range pats {
+		found := false
+		for _, p := range registry {
+			ok, err := path.Match(pat, p.name)
+			if err != nil {
+				return fmt.Errorf("bad pattern %q: %v", pat, err)
+			}
+			found = found || ok
+		}
+		if !found {
+			return fmt.Errorf("unknown pattern %q", pat)
+		}
+	}
+	return nil
+}
+
+// selectPatterns returns the members of list whose names match one of pats,
+// keeping the order of list. An empty pats selects everything.
+func selectPatterns(list []*pattern, pats []string) []*pattern {
+	if len(pats) == 0 {
+		return list
+	}
+
+	var out []*pattern
+	for _, p := range list {
+		for _, pat := range pats {
+			if ok, _ := path.Match(pat, p.name); ok {
+				out = append(out, p)
+				break
+			}
+		}
+	}
+	return out
+}
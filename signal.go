@@ -0,0 +1,64 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// signalImage is rendered by patterns defined in code values rather than
+// light, such as color bars. Its values are already encoded, with 0 for
+// black and 1 for white in the output primaries, so it is written without
+// going through encodeLinear, which makes one from a linearImage. Values
+// below 0 or above 1 are kept for video range output and are otherwise
+// clipped.
+type signalImage struct {
+	pix  []float32
+	rect image.Rectangle
+}
+
+func newSignalImage(s image.Point) *signalImage {
+	return &signalImage{
+		pix:  make([]float32, 3*s.X*s.Y),
+		rect: image.Rect(0, 0, s.X, s.Y),
+	}
+}
+
+func (img *signalImage) ColorModel() color.Model { return color.RGBA64Model }
+
+func (img *signalImage) Bounds() image.Rectangle { return img.rect }
+
+func (img *signalImage) At(x, y int) color.Color {
+	v := img.signal(x, y)
+	return color.RGBA64{R: signalLevel(v[0]), G: signalLevel(v[1]), B: signalLevel(v[2]), A: 65535}
+}
+
+// signal returns the unclipped value at x, y.
+func (img *signalImage) signal(x, y int) [3]float64 {
+	i := 3 * ((y-img.rect.Min.Y)*img.rect.Dx() + x - img.rect.Min.X)
+	return [3]float64{float64(img.pix[i]), float64(img.pix[i+1]), float64(img.pix[i+2])}
+}
+
+func (img *signalImage) set(x, y int, v [3]float64) {
+	i := 3 * ((y-img.rect.Min.Y)*img.rect.Dx() + x - img.rect.Min.X)
+	img.pix[i], img.pix[i+1], img.pix[i+2] = float32(v[0]), float32(v[1]), float32(v[2])
+}
+
+func (img *signalImage) fill(r image.Rectangle, v [3]float64) {
+	r = r.Intersect(img.rect)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			img.set(x, y, v)
+		}
+	}
+}
+
+// signalLevel clips a signal value to full range 16 bit.
+func signalLevel(v float64) uint16 {
+	return uint16(math.Round(math.Min(math.Max(v, 0), 1) * 65535))
+}
+
+// signalGray is a gray at v in every channel.
+func signalGray(v float64) [3]float64 {
+	return [3]float64{v, v, v}
+}
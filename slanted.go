@@ -0,0 +1,67 @@
+package main
+
+import (
+	"image"
+	"math"
+)
+
+// slantedEdge renders dark squares turned by angle degrees on bg, n across
+// the width and as many down as keeps the cells square, giving four edges
+// each for the slanted-edge method of ISO 12233. The squares are contrast
+// times darker than bg in linear light, and each pixel takes the exact
+// fraction of its area they cover, mixed in linear light.
+func slantedEdge(s image.Point, n int, p params) image.Image {
+	contrast := p.Float("contrast")
+	light := p.RGB("bg")
+	var dark [3]float64
+	for i := range light {
+		dark[i] = light[i] / contrast
+	}
+
+	cols := n
+	rows := max(1, int(math.Round(float64(n)*float64(s.Y)/float64(s.X))))
+	cellW, cellH := float64(s.X)/float64(cols), float64(s.Y)/float64(rows)
+	half := math.Min(cellW, cellH) / 4
+
+	// The edges of each square, as unit normals pointing inwards.
+	a := p.Float("angle") * math.Pi / 180
+	var normals [4]vec
+	for i := range normals {
+		t := a + float64(i)*math.Pi/2
+		normals[i] = vec{-math.Cos(t), -math.Sin(t)}
+	}
+
+	// cover returns the fraction of a pixel inside the square centered at c.
+	cover := func(x, y int, c vec) float64 {
+		px, py := float64(x)+0.5-c.x, float64(y)+0.5-c.y
+		inside := true
+		for _, d := range normals {
+			dist := d.x*px + d.y*py + half
+			if dist < -math.Sqrt2/2 {
+				return 0
+			}
+			if dist < math.Sqrt2/2 {
+				inside = false
+			}
+		}
+		if inside {
+			return 1
+		}
+		poly := pixelSquare(x, y)
+		for _, d := range normals {
+			poly = clip(poly, d.x, d.y, half-d.x*c.x-d.y*c.y)
+		}
+		return area(poly)
+	}
+
+	pic := newLinearImage(image.Rect(0, 0, s.X, s.Y))
+	for y := 0; y < s.Y; y++ {
+		row := min(int(float64(y)/cellH), rows-1)
+		for x := 0; x < s.X; x++ {
+			col := min(int(float64(x)/cellW), cols-1)
+			c := vec{(float64(col) + 0.5) * cellW, (float64(row) + 0.5) * cellH}
+			pic.set(x, y, mixLinear(light, dark, cover(x, y, c)))
+		}
+	}
+	return pic
+}
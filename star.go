@@ -0,0 +1,105 @@
+package main
+
+import (
+	"image"
+	"math"
+)
+
+// siemensStar renders n foreground wedges alternating with n background
+// ones around the center of the frame. The square profile gives each pixel
+// its exact area of coverage by the wedges, and the sine profile averages
+// 4×4 samples of a sinusoid in angle. Both are mixed in linear light. The
+// optional mask covers the middle, where the wedges are closer than two
+// pixels apart, out to the Nyquist radius n/π.
+func siemensStar(s image.Point, n int, p params) image.Image {
+	pic := newLinearImage(image.Rect(0, 0, s.X, s.Y))
+	fg, bg := p.RGB("fg"), p.RGB("bg")
+	maskColor := p.RGB("maskColor")
+	sine := p.Choice("profile") == "sine"
+	mask := p.Choice("mask") == "nyquist"
+
+	cx, cy := float64(s.X)/2, float64(s.Y)/2
+	period := 2 * math.Pi / float64(n)
+	nyquist := float64(n) / math.Pi
+
+	// wedges returns the coverage of a pixel by the foreground wedges.
+	wedges := func(x, y int) float64 {
+		px, py := float64(x)+0.5-cx, float64(y)+0.5-cy
+		d := math.Hypot(px, py)
+
+		// Only wedges within the pixel's angular extent can touch it.
+		first, last := 0, n-1
+		if d > 1.5 {
+			theta := math.Atan2(py, px)
+			w := math.Asin(math.Sqrt2/2/d) + 1e-9
+			first = int(math.Floor((theta - w) / period))
+			last = int(math.Floor((theta + w) / period))
+		}
+
+		var cover float64
+		for i := first; i <= last; i++ {
+			a0 := float64(i) * period
+			a1 := a0 + period/2
+			sq := pixelSquare(x, y)
+			for j := range sq {
+				sq[j].x -= cx
+				sq[j].y -= cy
+			}
+			// Left of the ray at a0 and right of the ray at a1.
+			poly := clip(sq, -math.Sin(a0), math.Cos(a0), 0)
+			poly = clip(poly, math.Sin(a1), -math.Cos(a1), 0)
+			cover += area(poly)
+		}
+		return math.Min(cover, 1)
+	}
+
+	sinusoid := func(x, y int) float64 {
+		var sum float64
+		for sy := 0; sy < 4; sy++ {
+			for sx := 0; sx < 4; sx++ {
+				px := float64(x) + (float64(sx)+0.5)/4 - cx
+				py := float64(y) + (float64(sy)+0.5)/4 - cy
+				sum += (1 + math.Cos(float64(n)*math.Atan2(py, px))) / 2
+			}
+		}
+		return sum / 16
+	}
+
+	// inside returns how much of a pixel lies within the mask.
+	inside := func(x, y int) float64 {
+		d := math.Hypot(float64(x)+0.5-cx, float64(y)+0.5-cy)
+		if d < nyquist-1 {
+			return 1
+		}
+		if d > nyquist+1 {
+			return 0
+		}
+		var in int
+		for sy := 0; sy < 4; sy++ {
+			for sx := 0; sx < 4; sx++ {
+				px := float64(x) + (float64(sx)+0.5)/4 - cx
+				py := float64(y) + (float64(sy)+0.5)/4 - cy
+				if math.Hypot(px, py) < nyquist {
+					in++
+				}
+			}
+		}
+		return float64(in) / 16
+	}
+
+	for y := 0; y < s.Y; y++ {
+		for x := 0; x < s.X; x++ {
+			var c [3]float64
+			if sine {
+				c = mixLinear(bg, fg, sinusoid(x, y))
+			} else {
+				c = mixLinear(bg, fg, wedges(x, y))
+			}
+			if mask {
+				c = mixLinear(c, maskColor, inside(x, y))
+			}
+			pic.set(x, y, c)
+		}
+	}
+	return pic
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"image"
+	"sync"
+
+	"github.com/fogleman/gg"
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+var (
+	labelFontOnce sync.Once
+	labelFont     *truetype.Font
+)
+
+// contrastInk is a quarter of the signal range lighter than dark
+// backgrounds and darker than light ones.
+func contrastInk(bg [3]float64) [3]float64 {
+	for i := range bg {
+		if bg[i] < 0.5 {
+			bg[i] += 0.25
+		} else {
+			bg[i] -= 0.25
+		}
+	}
+	return bg
+}
+
+// textLabel is a line of text centered at x, y.
+type textLabel struct {
+	text string
+	x, y float64
+}
+
+// labelFace returns the Go Regular font size pixels high.
+func labelFace(size float64) font.Face {
+	labelFontOnce.Do(func() {
+		var err error
+		if labelFont, err = truetype.Parse(goregular.TTF); err != nil {
+			panic(err)
+		}
+	})
+	return truetype.NewFace(labelFont, &truetype.Options{Size: size})
+}
+
+// labelMask draws labels white on transparent, in the Go Regular font
+// size pixels high, to use as a mask over an image of size s.
+func labelMask(s image.Point, labels []textLabel, size float64) *image.RGBA {
+	ctx := gg.NewContext(s.X, s.Y)
+	ctx.SetFontFace(labelFace(size))
+	ctx.SetRGB(1, 1, 1)
+	for _, l := range labels {
+		ctx.DrawStringAnchored(l.text, l.x, l.y, 0.5, 0.5)
+	}
+	return ctx.Image().(*image.RGBA)
+}
+
+// drawLabels draws labels size pixels high. ink gives the color of the text
+// over each signal value. Antialiased edges are blended in the signal
+// domain.
+func (img *signalImage) drawLabels(labels []textLabel, size float64, ink func([3]float64) [3]float64) {
+	s := img.rect.Size()
+	mask := labelMask(s, labels, size)
+	for y := 0; y < s.Y; y++ {
+		for x := 0; x < s.X; x++ {
+			a := float64(mask.Pix[mask.PixOffset(x, y)+3]) / 255
+			if a == 0 {
+				continue
+			}
+			px, py := x+img.rect.Min.X, y+img.rect.Min.Y
+			old := img.signal(px, py)
+			v := ink(old)
+			for i := range old {
+				old[i] += a * (v[i] - old[i])
+			}
+			img.set(px, py, old)
+		}
+	}
+}
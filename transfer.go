@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// transfer is an output transfer function. Patterns are rendered in linear
+// light, and encode maps that to the signal written to the file, both
+// running from 0 to 1. decode is its inverse.
+type transfer struct {
+	name        string
+	description string
+	encode      func(float64) float64
+	decode      func(float64) float64
+
+	// cicp is the ITU-T H.273 transfer characteristics code written to the
+	// PNG cICP chunk.
+	cicp byte
+
+	// hdr transfers place pattern white at peakNits.
+	hdr bool
+}
+
+var transfers = []*transfer{
+	{
+		name:        "srgb",
+		description: "IEC 61966-2-1 sRGB",
+		encode:      srgbEncode,
+		decode:      srgbDecode,
+		cicp:        13,
+	},
+	{
+		name:        "gamma2.2",
+		description: "pure power law, gamma 2.2",
+		encode:      gammaEncode(2.2),
+		decode:      gammaDecode(2.2),
+		cicp:        4,
+	},
+	{
+		name:        "gamma2.4",
+		description: "pure power law, gamma 2.4",
+		encode:      gammaEncode(2.4),
+		decode:      gammaDecode(2.4),
+		cicp:        1, // BT.709, whose reference display is BT.1886
+	},
+	{
+		name:        "linear",
+		description: "no encoding",
+		encode:      func(v float64) float64 { return v },
+		decode:      func(v float64) float64 { return v },
+		cicp:        8,
+	},
+	{
+		name:        "bt1886",
+		description: "ITU-R BT.1886 for a display with the black level set by -black-level",
+		encode:      bt1886Encode,
+		decode:      bt1886Decode,
+		cicp:        1,
+	},
+	{
+		name:        "pq",
+		description: "SMPTE ST 2084 perceptual quantizer, for HDR10",
+		encode:      pqEncode,
+		decode:      pqDecode,
+		cicp:        16,
+		hdr:         true,
+	},
+	{
+		name:        "hlg",
+		description: "ARIB STD-B67 hybrid log-gamma, for a 1000 cd/m² display",
+		encode:      hlgEncode,
+		decode:      hlgDecode,
+		cicp:        18,
+		hdr:         true,
+	},
+}
+
+// outputTransfer encodes every file but clamped variants.
+var outputTransfer = transfers[0]
+
+// blackLevel is the BT.1886 display black luminance as a fraction of white.
+var blackLevel = 0.0
+
+// peakNits is the luminance in cd/m² given to pattern white by the HDR
+// transfers. The default is the BT.2408 reference white.
+var peakNits = 203.0
+
+type transferFlag struct{}
+
+func (transferFlag) String() string {
+	return outputTransfer.name
+}
+
+func (transferFlag) Set(v string) error {
+	var names []string
+	for _, t := range transfers {
+		if strings.EqualFold(v, t.name) {
+			outputTransfer = t
+			return nil
+		}
+		names = append(names, t.name)
+	}
+	return fmt.Errorf("unknown transfer function %q: want one of %s", v, strings.Join(names, ", "))
+}
+
+const (
+	srgbA = 0.055
+	srgbE = 1.0 / 2.4
+)
+
+func srgbEncode(cl float64) float64 {
+	if cl <= 0.0031308 {
+		return cl * 12.92
+	}
+	return (srgbA+1)*math.Pow(cl, srgbE) - srgbA
+}
+
+func srgbDecode(csrgb float64) float64 {
+	if csrgb <= 0.04045 {
+		return csrgb / 12.92
+	}
+	return math.Pow((csrgb+srgbA)/(srgbA+1), 2.4)
+}
+
+func gammaEncode(gamma float64) func(float64) float64 {
+	return func(v float64) float64 { return math.Pow(v, 1/gamma) }
+}
+
+func gammaDecode(gamma float64) func(float64) float64 {
+	return func(v float64) float64 { return math.Pow(v, gamma) }
+}
+
+// bt1886Params returns the a and b of the BT.1886 EOTF, L = a*(V+b)^2.4,
+// for a display with white at 1 and black at blackLevel.
+func bt1886Params() (a, b float64) {
+	const gamma = 2.4
+	lw := 1.0
+	lb := math.Pow(blackLevel, 1/gamma)
+	a = math.Pow(lw-lb, gamma)
+	b = lb / (lw - lb)
+	return
+}
+
+func bt1886Encode(l float64) float64 {
+	a, b := bt1886Params()
+	return math.Max(math.Pow(l/a, 1/2.4)-b, 0)
+}
+
+func bt1886Decode(v float64) float64 {
+	a, b := bt1886Params()
+	return a * math.Pow(math.Max(v+b, 0), 2.4)
+}
+
+// SMPTE ST 2084 constants.
+const (
+	pqM1 = 2610.0 / 16384
+	pqM2 = 2523.0 / 4096 * 128
+	pqC1 = 3424.0 / 4096
+	pqC2 = 2413.0 / 4096 * 32
+	pqC3 = 2392.0 / 4096 * 32
+)
+
+func pqEncode(l float64) float64 {
+	y := math.Pow(math.Max(l*peakNits/10000, 0), pqM1)
+	return math.Pow((pqC1+pqC2*y)/(1+pqC3*y), pqM2)
+}
+
+func pqDecode(v float64) float64 {
+	e := math.Pow(math.Max(v, 0), 1/pqM2)
+	y := math.Pow(math.Max(e-pqC1, 0)/(pqC2-pqC3*e), 1/pqM1)
+	return y * 10000 / peakNits
+}
+
+// HLG constants, and the nominal display the signal is encoded for. Its
+// system gamma of 1.2 is applied to reach peakNits on that display.
+const (
+	hlgA     = 0.17883277
+	hlgB     = 1 - 4*hlgA
+	hlgNits  = 1000.0
+	hlgGamma = 1.2
+)
+
+var hlgC = 0.5 - hlgA*math.Log(4*hlgA)
+
+func hlgEncode(l float64) float64 {
+	e := math.Pow(math.Max(l*peakNits/hlgNits, 0), 1/hlgGamma)
+	if e <= 1.0/12 {
+		return math.Sqrt(3 * e)
+	}
+	return hlgA*math.Log(12*e-hlgB) + hlgC
+}
+
+func hlgDecode(v float64) float64 {
+	var e float64
+	if v <= 0.5 {
+		e = v * v / 3
+	} else {
+		e = (math.Exp((v-hlgC)/hlgA) + hlgB) / 12
+	}
+	return math.Pow(e, hlgGamma) * hlgNits / peakNits
+}
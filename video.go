@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"log"
+	"math"
+	"slices"
+	"strings"
+)
+
+// Output coding, set by -range, -excursions, -format, -chroma, -matrix and
+// -depth.
+var (
+	videoRange   = "full"
+	excursions   = false
+	outputFormat = "png"
+	chromaFormat = "444"
+	matrixName   = "" // by outputPrimaries if empty
+	yuvDepth     = 10
+)
+
+// choiceFlag sets a string to one of a fixed set of words.
+type choiceFlag struct {
+	value   *string
+	what    string
+	choices []string
+}
+
+func (f choiceFlag) String() string {
+	if f.value == nil {
+		return ""
+	}
+	return *f.value
+}
+
+func (f choiceFlag) Set(v string) error {
+	if !slices.Contains(f.choices, v) {
+		return fmt.Errorf("bad %s %q: want one of %s", f.what, v, strings.Join(f.choices, ", "))
+	}
+	*f.value = v
+	return nil
+}
+
+var (
+	rangeFlag  = choiceFlag{&videoRange, "range", []string{"full", "video"}}
+	formatFlag = choiceFlag{&outputFormat, "format", []string{"png", "yuv"}}
+	chromaFlag = choiceFlag{&chromaFormat, "chroma format", []string{"444", "422", "420"}}
+	matrixFlag = choiceFlag{&matrixName, "matrix", []string{"601", "709", "2020"}}
+)
+
+// ycbcrMatrix gives the luma weights of red and blue for a Y′CbCr matrix.
+type ycbcrMatrix struct {
+	name   string
+	kr, kb float64
+
+	// cicp is the ITU-T H.273 matrix coefficients code.
+	cicp byte
+}
+
+var ycbcrMatrices = []ycbcrMatrix{
+	{name: "601", kr: 0.299, kb: 0.114, cicp: 6},
+	{name: "709", kr: 0.2126, kb: 0.0722, cicp: 1},
+	{name: "2020", kr: 0.2627, kb: 0.0593, cicp: 9},
+}
+
+// outputMatrix is the matrix named by -matrix, or else the one that goes
+// with outputPrimaries.
+func outputMatrix() ycbcrMatrix {
+	name := matrixName
+	if name == "" {
+		name = "709"
+		if outputPrimaries == rec2020 {
+			name = "2020"
+		}
+	}
+	for _, m := range ycbcrMatrices {
+		if m.name == name {
+			return m
+		}
+	}
+	panic("unknown matrix " + name)
+}
+
+func checkYUVDepth(depth int) error {
+	if depth < 8 || depth > 16 {
+		return fmt.Errorf("bad depth %d: want 8 to 16 bits", depth)
+	}
+	return nil
+}
+
+// warnClipped warns about jobs whose levels below black or above white will
+// be clipped because the output cannot carry them. Patterns with a codes
+// parameter are checked code by code, as their codes only fall outside black
+// and white in video range.
+func warnClipped(jobs []*imageJob) {
+	carried := videoRange == "video" && excursions
+	warned := make(map[string]bool)
+	warn := func(format string, args ...any) {
+		msg := fmt.Sprintf(format, args...)
+		if !warned[msg] {
+			log.Print("warning: " + msg)
+			warned[msg] = true
+		}
+	}
+
+	for _, job := range jobs {
+		p := job.pattern
+		if !p.belowBlack && !p.aboveWhite {
+			continue
+		}
+
+		if codes, ok := job.params["codes"].([]int); ok {
+			_, _, lo, hi := codeLevels(job.numLines)
+			clipped := 0
+			for _, c := range codes {
+				if float64(c) < lo || float64(c) > hi {
+					clipped++
+				}
+			}
+			switch {
+			case clipped == 1:
+				warn("%s: n=%d: 1 code is outside %v-%v and is clipped", p.name, job.numLines, lo, hi)
+			case clipped > 1:
+				warn("%s: n=%d: %d codes are outside %v-%v and are clipped", p.name, job.numLines, clipped, lo, hi)
+			}
+			continue
+		}
+
+		if carried {
+			continue
+		}
+		if p.belowBlack {
+			warn("%s has levels below black, which are clipped without -range video -excursions", p.name)
+		}
+		if p.aboveWhite {
+			warn("%s has levels above white, which are clipped without -range video -excursions", p.name)
+		}
+	}
+}
+
+// codeLevels returns the codes for black and white at the given bit depth,
+// and the lowest and highest codes a signal may reach. Video range allows
+// excursions as far as the codes reserved for timing if enabled.
+func codeLevels(bits int) (black, white, lo, hi float64) {
+	top := float64(int(1)<<bits - 1)
+	if videoRange == "full" {
+		return 0, top, 0, top
+	}
+
+	scale := float64(int(1) << (bits - 8))
+	black, white = 16*scale, 235*scale
+	if excursions {
+		return black, white, scale, 255*scale - 1
+	}
+	return black, white, black, white
+}
+
+// quantize maps an encoded image to the codes of videoRange. It runs after
+// encodeLinear, and keeps any levels a signal image has outside 0 to 1 that
+// the range can carry. Full range images are returned as they are.
+func quantize(img image.Image) image.Image {
+	if videoRange == "full" {
+		return img
+	}
+
+	black, white, lo, hi := codeLevels(16)
+	code := func(v float64) uint16 {
+		return uint16(math.Min(math.Max(math.Round(black+v*(white-black)), lo), hi))
+	}
+
+	b := img.Bounds()
+	out := image.NewRGBA64(b)
+	sig, _ := img.(*signalImage)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			var v [3]float64
+			if sig != nil {
+				v = sig.signal(x, y)
+			} else {
+				c := color.RGBA64Model.Convert(img.At(x, y)).(color.RGBA64)
+				v = [3]float64{float64(c.R) / 65535, float64(c.G) / 65535, float64(c.B) / 65535}
+			}
+			out.SetRGBA64(x, y, color.RGBA64{R: code(v[0]), G: code(v[1]), B: code(v[2]), A: 65535})
+		}
+	}
+	return out
+}
+
+// encodeYCbCr writes img, whose values are codes from quantize, as raw
+// planar Y′CbCr: the Y′ plane, then Cb and Cr, with samples of more than 8
+// bits in two bytes, little endian. For 4:2:2 and 4:2:0, each chroma sample
+// is the mean of the two or four pixels it covers.
+func encodeYCbCr(w io.Writer, img image.Image) error {
+	m := outputMatrix()
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+
+	// ycc recovers the signal from the 16 bit codes and converts it.
+	black, white, _, _ := codeLevels(16)
+	ycc := func(x, y int) [3]float64 {
+		c := color.RGBA64Model.Convert(img.At(x+b.Min.X, y+b.Min.Y)).(color.RGBA64)
+		r := (float64(c.R) - black) / (white - black)
+		g := (float64(c.G) - black) / (white - black)
+		bl := (float64(c.B) - black) / (white - black)
+
+		luma := m.kr*r + (1-m.kr-m.kb)*g + m.kb*bl
+		return [3]float64{luma, (bl - luma) / (2 * (1 - m.kb)), (r - luma) / (2 * (1 - m.kr))}
+	}
+
+	sx, sy := 1, 1
+	switch chromaFormat {
+	case "422":
+		sx = 2
+	case "420":
+		sx, sy = 2, 2
+	}
+
+	// Chroma is centered on the middle code, and in video range spans 224
+	// codes at 8 bits, up to 240 without excursions.
+	yBlack, yWhite, yLo, yHi := codeLevels(yuvDepth)
+	cMid := float64(int(1) << (yuvDepth - 1))
+	cScale, cLo, cHi := yWhite-yBlack, yLo, yHi
+	if videoRange == "video" {
+		cScale = float64(int(224) << (yuvDepth - 8))
+		if !excursions {
+			cHi = float64(int(240) << (yuvDepth - 8))
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	put := func(v, lo, hi float64) {
+		code := uint16(math.Min(math.Max(math.Round(v), lo), hi))
+		if yuvDepth > 8 {
+			var buf [2]byte
+			binary.LittleEndian.PutUint16(buf[:], code)
+			bw.Write(buf[:])
+		} else {
+			bw.WriteByte(byte(code))
+		}
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			put(yBlack+ycc(x, y)[0]*(yWhite-yBlack), yLo, yHi)
+		}
+	}
+	for plane := 1; plane <= 2; plane++ {
+		for cy := 0; cy < height; cy += sy {
+			for cx := 0; cx < width; cx += sx {
+				var sum float64
+				var n int
+				for y := cy; y < min(cy+sy, height); y++ {
+					for x := cx; x < min(cx+sx, width); x++ {
+						sum += ycc(x, y)[plane]
+						n++
+					}
+				}
+				put(cMid+sum/float64(n)*cScale, cLo, cHi)
+			}
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"image"
+	"math"
+)
+
+// zonePlate renders a Fresnel zone plate, cos(π·kmax·r²/R + phase + kt·n),
+// where r is the distance in pixels from the center of the frame and R is
+// half its long side. The local frequency at r is kmax·r/R cycles per
+// pixel, rising linearly from 0 at the center to kmax at the ends of the
+// long axis. n is the frame number of a sequence, whose phase advances by
+// kt each frame.
+func zonePlate(s image.Point, n int, p params) image.Image {
+	pic := newLinearImage(image.Rect(0, 0, s.X, s.Y))
+
+	r := float64(max(s.X, s.Y)) / 2
+	k := math.Pi * p.Float("kmax") / r
+	phase := (p.Float("phase") + p.Float("kt")*float64(n)) * math.Pi / 180
+	cx, cy := float64(s.X-1)/2, float64(s.Y-1)/2
+
+	for y := 0; y < s.Y; y++ {
+		dy := float64(y) - cy
+		for x := 0; x < s.X; x++ {
+			dx := float64(x) - cx
+			pic.set(x, y, gray(math.Cos(k*(dx*dx+dy*dy)+phase)))
+		}
+	}
+	return pic
+}